@@ -0,0 +1,182 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/spf13/cobra"
+)
+
+var (
+	appendFilesPlatforms []string
+	appendFilesFlags     directoryLayerFlags
+	appendFilesComp      compressionFlags
+	appendFilesCreatedBy string
+	appendFilesComment   string
+)
+
+func init() {
+	CommandAppendFiles.Flags().StringArrayVar(&appendFilesPlatforms, "platform", nil, "only append the layer to images matching this platform (e.g. linux/arm64), can be repeated")
+	appendFilesFlags.addFlags(CommandAppendFiles.Flags())
+	CommandAppendFiles.Flags().BoolVar(&appendFilesFlags.preserveXattrs, "preserve-xattrs", false, "record the extended attributes of the source files (linux only), they depend on the host so the layer is no longer reproducible across machines")
+	appendFilesComp.addFlags(CommandAppendFiles.Flags())
+	CommandAppendFiles.Flags().StringVar(&appendFilesCreatedBy, "created-by", "image-tool append-files", "created_by recorded in the history entry of the appended layer")
+	CommandAppendFiles.Flags().StringVar(&appendFilesComment, "comment", "", "comment recorded in the history entry of the appended layer, defaults to the file mappings")
+}
+
+var CommandAppendFiles = cobra.Command{
+	Use:   "append-files oci-layout-path src:dst[:mode]...",
+	Short: "Appends a layer with the given files to every image in an OCI index",
+	Long: `Appends a single layer with the given files to every image in an OCI index.
+
+Every file is copied from src on disk to the absolute path dst in the image. A
+dst ending with a slash places the file in that directory under its own name
+(e.g. LICENSE:/licenses/). Missing parent directories are created, owned by
+root with mode 0755. The optional octal mode replaces the mode of the file, for
+a directory src it replaces the mode of the regular files in it.
+
+The layer is deterministic and created like the directory layers of
+append-layers: entries are sorted by dst, the tar format and timestamps are
+normalized and symlinks inside a directory are never followed. A src that is
+itself a symlink is resolved, like a Dockerfile COPY.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		oci := args[0]
+		mappings := args[1:]
+
+		if len(mappings) == 0 {
+			return
+		}
+
+		platforms := parsePlatforms(appendFilesPlatforms)
+		options := appendFilesFlags.options()
+		comp := appendFilesComp.options(cmd.Flags())
+
+		layer := newUntypedLayerFromFiles(parseFileMappings(mappings), options)
+		options.checkXattrsUsed()
+
+		layer.history = v1.History{
+			Created:   v1.Time{Time: sourceDateEpoch()},
+			CreatedBy: appendFilesCreatedBy,
+			Comment:   appendFilesComment,
+		}
+		if layer.history.Comment == "" {
+			layer.history.Comment = strings.Join(mappings, " ")
+		}
+
+		{
+			path, err := layout.FromPath(oci)
+			must("could not load oci directory", err)
+
+			index, err := path.ImageIndex()
+			must("could not load oci image index", err)
+
+			index, err = appendUntypedLayers(index, platforms, comp, []untypedLayer{layer}, nil)
+			must("could not modify oci tree", err)
+
+			writeLayout(cmd.OutOrStdout(), oci, index)
+		}
+	},
+}
+
+// fileMapping copies the file or directory src on disk to dst in the image.
+type fileMapping struct {
+	src string
+	// dst is the entry name in the image, as returned by normalizeEntryName
+	dst string
+
+	mode    int64
+	hasMode bool
+}
+
+// parseFileMappings parses "src:dst[:mode]" arguments, sorted by dst.
+func parseFileMappings(args []string) []fileMapping {
+	mappings := make([]fileMapping, 0, len(args))
+	for _, arg := range args {
+		mapping := parseFileMapping(arg)
+
+		stat, err := os.Stat(mapping.src)
+		must("could not open file", err)
+
+		if mapping.dst == "." && !stat.IsDir() {
+			fail("invalid file mapping %q, only a directory can be copied to the image root", arg)
+		}
+
+		mappings = append(mappings, mapping)
+	}
+
+	slices.SortStableFunc(mappings, func(a, b fileMapping) int {
+		return strings.Compare(a.dst, b.dst)
+	})
+
+	return mappings
+}
+
+// parseFileMapping parses a "src:dst[:mode]" argument. A dst ending with a
+// slash is a directory, the base name of src is appended to it.
+func parseFileMapping(arg string) fileMapping {
+	parts := strings.Split(arg, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		fail("invalid file mapping %q, must have the form src:dst[:mode]", arg)
+	}
+
+	mapping := fileMapping{src: parts[0], dst: parts[1]}
+	if len(parts) == 3 {
+		mapping.mode = parseMode("invalid mode in file mapping "+arg, parts[2])
+		mapping.hasMode = true
+	}
+
+	if strings.HasSuffix(mapping.dst, "/") {
+		mapping.dst = pathpkg.Join(mapping.dst, pathpkg.Base(filepath.ToSlash(mapping.src)))
+	}
+	mapping.dst = normalizeEntryName(mapping.dst, false)
+
+	return mapping
+}
+
+func newUntypedLayerFromFiles(mappings []fileMapping, opts directoryLayerOptions) untypedLayer {
+	spool := newSpoolFile("files-*.tar")
+	defer spool.Close()
+
+	bw := bufio.NewWriter(spool)
+	lw := newLayerWriter(bw)
+
+	for _, mapping := range mappings {
+		mappingOpts := opts
+		if mapping.hasMode {
+			mappingOpts.fileMode = mapping.mode
+			mappingOpts.overrideFileMode = true
+		}
+
+		must("could not write tarball", lw.writeParents(mapping.dst, mappingOpts))
+		must("could not write tarball", lw.writeTree(mapping.src, mapping.dst, mappingOpts))
+	}
+
+	must("could not write tarball", lw.close())
+	must("could not write tarball", bw.Flush())
+	must("could not write tarball", spool.Close())
+
+	return newUntypedLayer(fileOpener(spool.Name()))
+}
@@ -17,28 +17,75 @@ limitations under the License.
 package cmd
 
 import (
-	"archive/tar"
-	"bytes"
 	"fmt"
-	"io"
-	"io/fs"
-	"os"
-	"path/filepath"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
-	"github.com/google/go-containerregistry/pkg/v1/tarball"
-	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/spf13/cobra"
 
 	"github.com/cert-manager/image-tool/pkg"
 )
 
+var (
+	appendLayersPlatforms []string
+	appendLayersFlags     directoryLayerFlags
+	appendLayersComp      compressionFlags
+	appendLayersCreatedBy string
+	appendLayersComment   string
+	appendLayersConflicts string
+)
+
+func init() {
+	CommandAppendLayers.Flags().StringArrayVar(&appendLayersPlatforms, "platform", nil, "only append layers to images matching this platform (e.g. linux/arm64), can be repeated")
+	CommandAppendLayers.Flags().StringVar(&appendLayersFlags.dest, "dest", "/", "path in the image under which the contents of directories are placed")
+	appendLayersFlags.addFlags(CommandAppendLayers.Flags())
+	CommandAppendLayers.Flags().BoolVar(&appendLayersFlags.preserveXattrs, "preserve-xattrs", false, "record the extended attributes of the source files in directory layers (linux only), they depend on the host so the layer is no longer reproducible across machines")
+	appendLayersComp.addFlags(CommandAppendLayers.Flags())
+	CommandAppendLayers.Flags().StringVar(&appendLayersCreatedBy, "created-by", "image-tool append-layers", "created_by recorded in the history entry of the appended layers")
+	CommandAppendLayers.Flags().StringVar(&appendLayersComment, "comment", "", "comment recorded in the history entry of the appended layers, defaults to the source path of the layer")
+	CommandAppendLayers.Flags().StringVar(&appendLayersConflicts, "conflicts", conflictsIgnore, "report appended paths that overwrite a file or replace a directory with a file in the image: warn, error or ignore")
+}
+
 var CommandAppendLayers = cobra.Command{
-	Use:   "append-layers oci-layout-path [path-to-tarball...]",
+	Use:   "append-layers oci-layout-path [[platform=]path-to-tarball...]",
 	Short: "Appends a tarball or directory to every image in an OCI index",
-	Args:  cobra.MinimumNArgs(1),
+	Long: `Appends a tarball or directory to every image in an OCI index.
+
+A path can be prefixed with a platform (e.g. linux/arm64=./bin/arm64), in which
+case the layer is only appended to the images matching that platform. A
+platform prefix or --platform that matches no image is an error.
+
+Layers created from directories are deterministic: the same directory results
+in the same uncompressed layer (diff_id) on every machine and with every Go
+version. The digest of a compressed layer also depends on the gzip or zstd
+encoder, which can change between releases, use --compression none for a layer
+digest that is as stable as the diff_id. Entries are written in lexical order
+using the PAX tar format, without access and change times, with the
+modification time set to SOURCE_DATE_EPOCH (or the unix epoch if it is not
+set), with names relative to the image root and a trailing slash for
+directories. Symlinks are recorded with their target and are never followed,
+hardlinked files are stored once and recorded as hardlinks for the other paths.
+FIFOs and device nodes are recorded, sockets are rejected. A source directory
+that is a symlink is resolved. The directory the contents are placed in (the
+image root or --dest) is owned by root with mode 0755.
+
+Every appended layer gets a history entry with the --created-by and --comment
+values (the comment defaults to the source path) and SOURCE_DATE_EPOCH as
+creation time.
+
+With --preserve-xattrs, extended attributes of the source files (except
+security.selinux) are preserved on linux and recorded as PAX SCHILY.xattr
+records. They depend on the host, so they are not preserved by default.
+Attributes and file capabilities can also be set per image path using --xattr
+and --cap, e.g.
+--cap /app=cap_net_bind_service+ep.
+
+With --conflicts=warn or --conflicts=error, the merged filesystem of every image
+is computed and every appended path that overwrites an existing file or
+replaces a directory with a file is reported with the old and new modes and
+sizes. With error, nothing is written if a conflict is found.`,
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		oci := args[0]
 		extra := args[1:]
@@ -47,6 +94,11 @@ var CommandAppendLayers = cobra.Command{
 			return
 		}
 
+		platforms := parsePlatforms(appendLayersPlatforms)
+		options := appendLayersFlags.options()
+		comp := appendLayersComp.options(cmd.Flags())
+		conflicts := newConflictReport(cmd.ErrOrStderr(), appendLayersConflicts)
+
 		{
 			path, err := layout.FromPath(oci)
 			must("could not load oci directory", err)
@@ -54,137 +106,151 @@ var CommandAppendLayers = cobra.Command{
 			index, err := path.ImageIndex()
 			must("could not load oci image index", err)
 
+			created := sourceDateEpoch()
+
 			layers := []untypedLayer{}
-			for _, path := range extra {
-				layers = append(layers, newUntypedLayerFromPath(path))
+			for _, arg := range extra {
+				layer := newUntypedLayerFromArg(arg, options)
+
+				layer.history = v1.History{
+					Created:   v1.Time{Time: created},
+					CreatedBy: appendLayersCreatedBy,
+					Comment:   appendLayersComment,
+				}
+				if layer.history.Comment == "" {
+					layer.history.Comment = layer.source
+				}
+
+				layers = append(layers, layer)
 			}
+			options.checkXattrsUsed()
 
-			index, err = pkg.MutateOCITree(
-				index, nil,
-				func(img v1.Image) (v1.Image, error) {
-					imgMediaType, err := img.MediaType()
-					if err != nil {
-						return nil, fmt.Errorf("could not get image media type: %w", err)
-					}
-
-					layerType := types.DockerLayer
-					if imgMediaType == types.OCIManifestSchema1 {
-						layerType = types.OCILayer
-					}
-
-					for _, untypedLayer := range layers {
-						layer, err := untypedLayer.ToLayer(layerType)
-						if err != nil {
-							return nil, fmt.Errorf("could not load image layer: %w", err)
-						}
-
-						img, err = mutate.AppendLayers(img, layer)
-						if err != nil {
-							return nil, fmt.Errorf("could not append layer: %w", err)
-						}
-					}
-
-					return img, nil
-				},
-				nil,
-			)
+			index, err = appendUntypedLayers(index, platforms, comp, layers, conflicts)
 			must("could not modify oci tree", err)
 
-			_, err = layout.Write(oci, index)
-			must("could not write image", err)
-		}
+			conflicts.check()
 
-		{
-			path, err := layout.FromPath(oci)
-			must("could not load oci directory", err)
-
-			hashesToRemove, err := path.GarbageCollect()
-			must("could not garbage collect oci image", err)
-
-			for _, hash := range hashesToRemove {
-				err := path.RemoveBlob(hash)
-				must("could not remove blob", err)
-			}
+			writeLayout(cmd.OutOrStdout(), oci, index)
 		}
 	},
 }
 
-type untypedLayer struct {
-	tarball tarball.Opener
-}
+// appendUntypedLayers appends the layers to every image in the OCI tree that
+// matches the platforms, using the media type that matches the image.
+func appendUntypedLayers(
+	index v1.ImageIndex,
+	platforms []v1.Platform,
+	comp layerCompression,
+	layers []untypedLayer,
+	conflicts *conflictReport,
+) (v1.ImageIndex, error) {
+	// A layer keyed with a platform that matches no image would silently
+	// not be appended
+	var layerPlatforms []v1.Platform
+	for _, untypedLayer := range layers {
+		if untypedLayer.platform != nil {
+			layerPlatforms = append(layerPlatforms, *untypedLayer.platform)
+		}
+	}
+	if err := checkPlatformsMatch(index, platforms, layerPlatforms); err != nil {
+		return nil, fmt.Errorf("invalid layer platform: %w", err)
+	}
 
-func newUntypedLayer(tarball tarball.Opener) untypedLayer {
-	return untypedLayer{tarball: tarball}
+	return appendPlatformLayers(index, platforms, comp, conflicts, func(platform *v1.Platform) ([]untypedLayer, error) {
+		var matching []untypedLayer
+		for _, untypedLayer := range layers {
+			if untypedLayer.MatchesPlatform(platform) {
+				matching = append(matching, untypedLayer)
+			}
+		}
+		return matching, nil
+	})
 }
 
-func newUntypedLayerFromPath(path string) untypedLayer {
-	stat, err := os.Stat(path)
-	must("could not open directory or tarball", err)
-
-	var layer untypedLayer
-	if stat.IsDir() {
-		var buf bytes.Buffer
-
-		tw := tar.NewWriter(&buf)
-
-		root, err := os.OpenRoot(path)
-		must("could not open root directory", err)
-		defer root.Close()
-
-		_ = filepath.Walk(path, func(target string, info fs.FileInfo, err error) error {
-			must("walk error", err)
-
-			header, err := tar.FileInfoHeader(info, info.Name())
-			must("could not create tar header", err)
-
-			name, err := filepath.Rel(path, target)
-			must("could not build relative path", err)
-
-			// Write simplified header, this removes all fields that would cause
-			// the build to be non-reproducible (like modtime for example)
-			err = tw.WriteHeader(&tar.Header{
-				Typeflag: header.Typeflag,
-				Name:     name,
-				Mode:     header.Mode,
-				Linkname: header.Linkname,
-				Size:     header.Size,
-			})
+// appendPlatformLayers appends the layers returned by layersFor to every image
+// in the OCI tree that matches the platforms, using the media type that
+// matches the image. If conflicts is not nil, the paths of the layers that
+// conflict with the image are reported to it.
+func appendPlatformLayers(
+	index v1.ImageIndex,
+	platforms []v1.Platform,
+	comp layerCompression,
+	conflicts *conflictReport,
+	layersFor func(platform *v1.Platform) ([]untypedLayer, error),
+) (v1.ImageIndex, error) {
+	if err := checkPlatformsMatch(index, nil, platforms); err != nil {
+		return nil, fmt.Errorf("invalid --platform: %w", err)
+	}
 
-			must("could not write tar header", err)
+	return pkg.MutateOCITreeWithDescriptors(
+		index, nil,
+		func(descriptors []*v1.Descriptor, img v1.Image) (v1.Image, error) {
+			platform, err := pkg.ImagePlatform(descriptors, img)
+			if err != nil {
+				return nil, err
+			}
 
-			if !info.IsDir() {
-				file, err := root.Open(name)
-				must("could not write tar contents", err)
+			if !pkg.MatchesPlatform(platform, platforms) {
+				return img, nil
+			}
 
-				defer file.Close()
+			layers, err := layersFor(platform)
+			if err != nil {
+				return nil, err
+			}
 
-				_, err = io.Copy(tw, file)
-				must("could not write tar contents", err)
+			if len(layers) == 0 {
+				return img, nil
 			}
 
-			return nil
-		})
+			imgMediaType, err := img.MediaType()
+			if err != nil {
+				return nil, fmt.Errorf("could not get image media type: %w", err)
+			}
 
-		tw.Close()
+			layerType, err := comp.MediaType(imgMediaType)
+			if err != nil {
+				return nil, err
+			}
 
-		byts := buf.Bytes()
+			var fs *pkg.FileSystem
+			if conflicts != nil {
+				imgLayers, err := img.Layers()
+				if err != nil {
+					return nil, fmt.Errorf("could not get image layers: %w", err)
+				}
+
+				fs, err = pkg.NewFileSystem(imgLayers)
+				if err != nil {
+					return nil, fmt.Errorf("could not read image filesystem: %w", err)
+				}
+			}
 
-		layer = newUntypedLayer(
-			func() (io.ReadCloser, error) {
-				return io.NopCloser(bytes.NewReader(byts)), nil
-			},
-		)
-	} else {
-		layer = newUntypedLayer(
-			func() (io.ReadCloser, error) {
-				return os.Open(path)
-			},
-		)
-	}
+			for _, untypedLayer := range layers {
+				layer, err := untypedLayer.ToLayer(comp, layerType)
+				if err != nil {
+					return nil, fmt.Errorf("could not load image layer: %w", err)
+				}
 
-	return layer
-}
+				if fs != nil {
+					found, err := fs.Apply(layer)
+					if err != nil {
+						return nil, fmt.Errorf("could not read appended layer: %w", err)
+					}
+					conflicts.report(platform, found)
+				}
+
+				img, err = mutate.Append(img, mutate.Addendum{
+					Layer:   layer,
+					History: untypedLayer.history,
+				})
+				if err != nil {
+					return nil, fmt.Errorf("could not append layer: %w", err)
+				}
+			}
 
-func (ul untypedLayer) ToLayer(mediaType types.MediaType) (v1.Layer, error) {
-	return tarball.LayerFromOpener(ul.tarball, tarball.WithMediaType(mediaType))
+			return img, nil
+		},
+		nil,
+	)
 }
@@ -0,0 +1,169 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/google/go-containerregistry/pkg/compression"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/pflag"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// compressionFlags holds the unparsed command line flags that control how
+// new layers are compressed.
+type compressionFlags struct {
+	algorithm string
+	level     int
+}
+
+func (f *compressionFlags) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&f.algorithm, "compression", string(compression.GZip), "compression of new layers: gzip, zstd or none")
+	flags.IntVar(&f.level, "compression-level", 0, "compression level of new layers, defaults to 1 for gzip and 3 for zstd")
+}
+
+// options validates the flags, the flag set is used to tell an explicit
+// --compression-level from the default.
+func (f *compressionFlags) options(flags *pflag.FlagSet) layerCompression {
+	comp := layerCompression{
+		algorithm: compression.Compression(f.algorithm),
+		level:     f.level,
+	}
+	levelSet := flags.Changed("compression-level")
+
+	switch comp.algorithm {
+	case compression.GZip:
+		if !levelSet {
+			comp.level = gzip.BestSpeed
+		}
+		if comp.level < gzip.HuffmanOnly || comp.level > gzip.BestCompression {
+			fail("invalid --compression-level: gzip level must be between %d and %d", gzip.HuffmanOnly, gzip.BestCompression)
+		}
+	case compression.ZStd:
+		if !levelSet {
+			comp.level = 3
+		}
+		if comp.level < 1 || comp.level > 22 {
+			fail("invalid --compression-level: zstd level must be between 1 and 22")
+		}
+	case compression.None:
+		if levelSet {
+			fail("invalid --compression-level: uncompressed layers have no compression level")
+		}
+	default:
+		fail("invalid --compression %q: must be gzip, zstd or none", f.algorithm)
+	}
+
+	return comp
+}
+
+// layerCompression describes how new layers are compressed.
+type layerCompression struct {
+	algorithm compression.Compression
+	level     int
+}
+
+// MediaType returns the layer media type for the compression in an image with
+// the given manifest media type. Docker schema2 images don't support zstd.
+func (comp layerCompression) MediaType(imgMediaType types.MediaType) (types.MediaType, error) {
+	oci := imgMediaType == types.OCIManifestSchema1
+
+	switch comp.algorithm {
+	case compression.GZip:
+		if oci {
+			return types.OCILayer, nil
+		}
+		return types.DockerLayer, nil
+	case compression.ZStd:
+		if oci {
+			return types.OCILayerZStd, nil
+		}
+		return "", fmt.Errorf("zstd compressed layers are not supported in %s images", imgMediaType)
+	case compression.None:
+		if oci {
+			return types.OCIUncompressedLayer, nil
+		}
+		return types.DockerUncompressedLayer, nil
+	default:
+		return "", fmt.Errorf("unsupported compression %q", comp.algorithm)
+	}
+}
+
+// NewWriter returns a writer that compresses the data written to w.
+func (comp layerCompression) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	switch comp.algorithm {
+	case compression.GZip:
+		return gzip.NewWriterLevel(w, comp.level)
+	case compression.ZStd:
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(comp.level)))
+	case compression.None:
+		return nopWriteCloser{w}, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", comp.algorithm)
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// peekCompression detects the compression of the stream without consuming it.
+func peekCompression(r *bufio.Reader) (compression.Compression, error) {
+	magic, err := r.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return compression.None, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return compression.GZip, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		return compression.ZStd, nil
+	default:
+		return compression.None, nil
+	}
+}
+
+// newDecompressReader returns a reader that decompresses r.
+func newDecompressReader(r io.Reader, comp compression.Compression) (io.ReadCloser, error) {
+	switch comp {
+	case compression.GZip:
+		return gzip.NewReader(r)
+	case compression.ZStd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return io.NopCloser(r), nil
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/compression"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/spf13/pflag"
+)
+
+func TestCompressionFlagsOptions(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected layerCompression
+	}{
+		{
+			args:     nil,
+			expected: layerCompression{algorithm: compression.GZip, level: gzip.BestSpeed},
+		},
+		{
+			args:     []string{"--compression-level", "-1"},
+			expected: layerCompression{algorithm: compression.GZip, level: gzip.DefaultCompression},
+		},
+		{
+			args:     []string{"--compression-level", "0"},
+			expected: layerCompression{algorithm: compression.GZip, level: gzip.NoCompression},
+		},
+		{
+			args:     []string{"--compression", "zstd"},
+			expected: layerCompression{algorithm: compression.ZStd, level: 3},
+		},
+		{
+			args:     []string{"--compression", "zstd", "--compression-level", "19"},
+			expected: layerCompression{algorithm: compression.ZStd, level: 19},
+		},
+		{
+			args:     []string{"--compression", "none"},
+			expected: layerCompression{algorithm: compression.None},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.args), func(t *testing.T) {
+			var f compressionFlags
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			f.addFlags(flags)
+			if err := flags.Parse(test.args); err != nil {
+				t.Fatal(err)
+			}
+
+			if comp := f.options(flags); comp != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, comp)
+			}
+		})
+	}
+}
+
+func TestLayerCompressionMediaType(t *testing.T) {
+	tests := []struct {
+		algorithm     compression.Compression
+		imgMediaType  types.MediaType
+		expected      types.MediaType
+		expectedError bool
+	}{
+		{algorithm: compression.GZip, imgMediaType: types.OCIManifestSchema1, expected: types.OCILayer},
+		{algorithm: compression.GZip, imgMediaType: types.DockerManifestSchema2, expected: types.DockerLayer},
+		{algorithm: compression.ZStd, imgMediaType: types.OCIManifestSchema1, expected: types.OCILayerZStd},
+		{algorithm: compression.ZStd, imgMediaType: types.DockerManifestSchema2, expectedError: true},
+		{algorithm: compression.None, imgMediaType: types.OCIManifestSchema1, expected: types.OCIUncompressedLayer},
+		{algorithm: compression.None, imgMediaType: types.DockerManifestSchema2, expected: types.DockerUncompressedLayer},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.algorithm)+" "+string(test.imgMediaType), func(t *testing.T) {
+			mediaType, err := layerCompression{algorithm: test.algorithm}.MediaType(test.imgMediaType)
+			if test.expectedError {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", mediaType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if mediaType != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, mediaType)
+			}
+		})
+	}
+}
+
+func TestLayerCompressionRoundTrip(t *testing.T) {
+	for _, algorithm := range []compression.Compression{compression.GZip, compression.ZStd, compression.None} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			comp := layerCompression{algorithm: algorithm, level: 1}
+
+			var buf bytes.Buffer
+			w, err := comp.NewWriter(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.WriteString(w, "layer contents"); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			br := bufio.NewReader(&buf)
+			detected, err := peekCompression(br)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if detected != algorithm {
+				t.Errorf("expected compression %q to be detected, got %q", algorithm, detected)
+			}
+
+			r, err := newDecompressReader(br, detected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			contents, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(contents) != "layer contents" {
+				t.Errorf("expected %q, got %q", "layer contents", contents)
+			}
+		})
+	}
+}
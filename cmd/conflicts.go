@@ -0,0 +1,94 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/cert-manager/image-tool/pkg"
+)
+
+const (
+	conflictsIgnore = "ignore"
+	conflictsWarn   = "warn"
+	conflictsError  = "error"
+)
+
+// conflictReport reports the paths of appended layers that overwrite paths of
+// the image they are appended to.
+type conflictReport struct {
+	w     io.Writer
+	mode  string
+	count int
+}
+
+// newConflictReport returns nil for "ignore", so no conflicts are computed.
+// The conflicts are written to w.
+func newConflictReport(w io.Writer, mode string) *conflictReport {
+	switch mode {
+	case conflictsIgnore:
+		return nil
+	case conflictsWarn, conflictsError:
+		return &conflictReport{w: w, mode: mode}
+	default:
+		fail("invalid --conflicts value %q, must be one of %s, %s or %s", mode, conflictsWarn, conflictsError, conflictsIgnore)
+		return nil
+	}
+}
+
+// report prints the conflicts of a layer appended to the image with the
+// platform.
+func (r *conflictReport) report(platform *v1.Platform, conflicts []pkg.Conflict) {
+	image := "image"
+	if platform != nil {
+		image = fmt.Sprintf("image %q", platform)
+	}
+
+	for _, conflict := range conflicts {
+		fmt.Fprintf(r.w, "%s: %s: /%s: %s is replaced by %s\n", r.mode, image, conflict.Path, describeEntry(conflict.Old), describeEntry(conflict.New))
+	}
+	r.count += len(conflicts)
+}
+
+// check fails if conflicts were found and the mode is "error".
+func (r *conflictReport) check() {
+	if r != nil && r.mode == conflictsError && r.count > 0 {
+		fail("found %d conflicting paths in the appended layers", r.count)
+	}
+}
+
+func describeEntry(header *tar.Header) string {
+	kind := "file"
+	switch header.Typeflag {
+	case tar.TypeDir:
+		kind = "directory"
+	case tar.TypeSymlink:
+		kind = "symlink to " + header.Linkname
+	case tar.TypeLink:
+		kind = "hardlink to /" + pkg.CleanEntryName(header.Linkname)
+	case tar.TypeChar, tar.TypeBlock:
+		kind = "device"
+	case tar.TypeFifo:
+		kind = "fifo"
+	}
+
+	return fmt.Sprintf("%s (mode %04o, %d bytes)", kind, header.Mode&0o7777, header.Size)
+}
@@ -18,49 +18,123 @@ package cmd
 
 import (
 	"archive/tar"
+	"bufio"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 
-	"github.com/google/go-containerregistry/pkg/v1/layout"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/spf13/cobra"
+
+	"github.com/cert-manager/image-tool/pkg"
 )
 
-const maxFileSize = 500 * 1 << 20 // 500 Megabyte = 500 * 1024 * 1024 bytes
+// untarLimits protects against decompression bombs, a limit of 0 disables it.
+type untarLimits struct {
+	fileSize  int64
+	totalSize int64
+	entries   int64
+}
+
+var convertFromOCITarLimits untarLimits
+
+func init() {
+	CommandConvertFromOCITar.Flags().Int64Var(&convertFromOCITarLimits.fileSize, "max-file-size", 500<<20, "maximum size in bytes of a file in the tarball (0 disables the limit)")
+	CommandConvertFromOCITar.Flags().Int64Var(&convertFromOCITarLimits.totalSize, "max-total-size", 20<<30, "maximum total size in bytes of the files in the tarball (0 disables the limit)")
+	CommandConvertFromOCITar.Flags().Int64Var(&convertFromOCITarLimits.entries, "max-entries", 100000, "maximum number of entries in the tarball (0 disables the limit)")
+}
 
 var CommandConvertFromOCITar = cobra.Command{
 	Use:   "convert-from-oci-tar oci-tarball oci-layout-path",
 	Short: "Reads the OCI layout tarball (=docker build output) and outputs an OCI layout directory (=ko output, crane and image-tool input)",
-	Args:  cobra.ExactArgs(2),
+	Long: `Reads the OCI layout tarball (=docker build output) and outputs an OCI layout
+directory (=ko output, crane and image-tool input).
+
+Gzip and zstd compressed tarballs are detected automatically. Use - as
+oci-tarball to read the tarball from stdin, e.g.
+docker buildx build --output type=oci,dest=- . | image-tool convert-from-oci-tar - ./oci
+
+Symlinks and hardlinks (e.g. a symlinked blobs directory) are extracted as
+links. Symlinks must have a relative target that resolves to a path inside
+the output directory, hardlinks must point to a file in the tarball.
+
+To protect against decompression bombs, the size of every file, the total size
+of the files and the number of entries are limited, see --max-file-size,
+--max-total-size and --max-entries.`,
+	Args: cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		path := args[0]
 		output := args[1]
 
-		{
-			err := untar(path, output)
+		if convertFromOCITarLimits.fileSize < 0 || convertFromOCITarLimits.totalSize < 0 || convertFromOCITarLimits.entries < 0 {
+			fail("--max-file-size, --max-total-size and --max-entries must not be negative")
+		}
+
+		if dryRun {
+			// The tarball is extracted to a temporary directory, so the
+			// layout and the blobs that would be removed can be reported
+			dir, err := os.MkdirTemp("", "image-tool-dry-run-")
+			must("could not create temporary directory", err)
+			addCleanup(func() {
+				_ = os.RemoveAll(dir)
+			})
+
+			err = untar(path, dir, convertFromOCITarLimits)
 			must("could not untar OCI tarball", err)
+
+			// A real run extracts over the existing output, replacing its
+			// index and garbage collecting its blobs. The trees are not
+			// related, so the existing descriptors are reported as removed
+			// and the extracted descriptors as added.
+			var before v1.ImageIndex
+			var changes []pkg.DescriptorChange
+			existing := map[v1.Hash]int64{}
+			if _, err := os.Stat(filepath.Join(output, "index.json")); err == nil {
+				before = loadIndex(output)
+
+				changes, err = pkg.DiffOCITree(before, nil)
+				must("could not compare oci tree", err)
+
+				existing, err = listBlobs(output)
+				must("could not list blobs", err)
+			}
+
+			after := loadIndex(dir)
+
+			added, err := pkg.DiffOCITree(nil, after)
+			must("could not compare oci tree", err)
+			changes = append(changes, added...)
+
+			incoming, err := listBlobs(dir)
+			must("could not list blobs", err)
+
+			reportDryRun(cmd.OutOrStdout(), before, after, changes, existing, incoming)
+			return
 		}
 
 		{
-			path, err := layout.FromPath(output)
-			must("could not load oci directory", err)
+			err := untar(path, output, convertFromOCITarLimits)
+			must("could not untar OCI tarball", err)
+		}
 
-			hashesToRemove, err := path.GarbageCollect()
+		{
+			referenced, err := pkg.ReferencedBlobs(loadIndex(output))
 			must("could not garbage collect oci image", err)
 
-			for _, hash := range hashesToRemove {
-				err := path.RemoveBlob(hash)
-				must("could not remove blob", err)
-			}
+			err = garbageCollect(output, referenced)
+			must("could not garbage collect oci image", err)
 		}
 	},
 }
 
-func cleanJoin(root, dest string) (string, error) {
-	path := path.Clean("/" + dest)[1:]
+// cleanPath returns the entry name as a local path relative to the root.
+func cleanPath(name string) (string, error) {
+	path := path.Clean("/" + name)[1:]
 	if path == "" {
 		path = "."
 	}
@@ -70,17 +144,50 @@ func cleanJoin(root, dest string) (string, error) {
 		return "", errors.New("invalid or unsafe file path")
 	}
 
-	return filepath.Join(root, path), nil
+	return path, nil
 }
 
-func untar(src string, dest string) error {
-	file, err := os.Open(src)
+// untar extracts the tarball src, or stdin if src is "-", to dest. Gzip and
+// zstd compressed tarballs are detected and decompressed. All files are
+// created through an os.Root, so nothing is written outside of dest, and
+// symlinks that resolve to a path outside of dest are rejected.
+func untar(src string, dest string, limits untarLimits) error {
+	file := os.Stdin
+	if src != "-" {
+		var err error
+		file, err = os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+	}
+
+	br := bufio.NewReader(file)
+	comp, err := peekCompression(br)
+	if err != nil {
+		return fmt.Errorf("could not detect compression: %w", err)
+	}
+
+	reader, err := newDecompressReader(br, comp)
+	if err != nil {
+		return fmt.Errorf("could not decompress %s tarball: %w", comp, err)
+	}
+	defer reader.Close()
+
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+
+	root, err := os.OpenRoot(dest)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	defer root.Close()
+
+	var symlinks []*tar.Header
+	var entries, totalSize int64
 
-	tarReader := tar.NewReader(file)
+	tarReader := tar.NewReader(reader)
 	for {
 		header, err := tarReader.Next()
 		if err == io.EOF {
@@ -90,32 +197,178 @@ func untar(src string, dest string) error {
 			return err
 		}
 
-		path, err := cleanJoin(dest, header.Name)
+		entries++
+		if limits.entries > 0 && entries > limits.entries {
+			return fmt.Errorf("entry %s exceeds the limit of %d entries (--max-entries)", header.Name, limits.entries)
+		}
+
+		path, err := cleanPath(header.Name)
 		if err != nil {
 			return err
 		}
 
+		if header.Typeflag != tar.TypeDir {
+			if err := root.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+		}
+
 		switch header.Typeflag {
 		case tar.TypeDir:
-			if err := os.MkdirAll(path, 0755); err != nil {
+			if err := root.MkdirAll(path, 0755); err != nil {
 				return err
 			}
 		case tar.TypeReg:
-			outFile, err := os.Create(path)
+			// Prevents G110: Potential DoS vulnerability via decompression bomb,
+			// the tar reader never returns more than header.Size bytes
+			if limits.fileSize > 0 && header.Size > limits.fileSize {
+				return fmt.Errorf("file %s is %d bytes, which exceeds the limit of %d bytes per file (--max-file-size)", header.Name, header.Size, limits.fileSize)
+			}
+			totalSize += header.Size
+			if limits.totalSize > 0 && totalSize > limits.totalSize {
+				return fmt.Errorf("file %s brings the total size to %d bytes, which exceeds the limit of %d bytes (--max-total-size)", header.Name, totalSize, limits.totalSize)
+			}
+
+			// Creating the file over an existing hardlink would truncate
+			// the contents of the other paths of the link
+			if err := removeExisting(root, path); err != nil {
+				return err
+			}
+
+			outFile, err := root.Create(path)
 			if err != nil {
 				return err
 			}
-			written, err := io.Copy(outFile, io.LimitReader(tarReader, maxFileSize))
+			_, err = io.CopyN(outFile, tarReader, header.Size)
 			outFile.Close()
 			if err != nil {
 				return err
-			} else if written == maxFileSize {
-				// Prevents G110: Potential DoS vulnerability via decompression bomb
-				return fmt.Errorf("tar contained file larger than 500MB")
+			}
+		case tar.TypeSymlink:
+			if err := checkSymlink(root, header); err != nil {
+				return err
+			}
+			if err := removeExisting(root, path); err != nil {
+				return err
+			}
+			if err := root.Symlink(filepath.FromSlash(header.Linkname), path); err != nil {
+				return err
+			}
+			symlinks = append(symlinks, header)
+		case tar.TypeLink:
+			target, err := cleanPath(header.Linkname)
+			if err != nil {
+				return fmt.Errorf("hardlink %s points to %s: %w", header.Name, header.Linkname, err)
+			}
+			info, err := root.Lstat(target)
+			if err != nil {
+				return fmt.Errorf("hardlink %s points to %s: %w", header.Name, header.Linkname, err)
+			}
+			if info.IsDir() {
+				return fmt.Errorf("hardlink %s points to directory %s", header.Name, header.Linkname)
+			}
+			if err := removeExisting(root, path); err != nil {
+				return err
+			}
+			if err := root.Link(target, path); err != nil {
+				return err
 			}
 		default:
 			return fmt.Errorf("unable to untar type: %c in file %s", header.Typeflag, header.Name)
 		}
 	}
+
+	// A symlink that was created later can change where an earlier symlink
+	// resolves to, so all symlinks are checked again
+	for _, header := range symlinks {
+		if err := checkSymlink(root, header); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
+
+// checkSymlink fails if the target of the symlink is absolute or resolves to a
+// path outside of the root.
+func checkSymlink(root *os.Root, header *tar.Header) error {
+	if path.IsAbs(header.Linkname) {
+		return fmt.Errorf("symlink %s has absolute target %s, only relative targets are supported", header.Name, header.Linkname)
+	}
+
+	name := path.Clean("/" + header.Name)[1:]
+	if _, err := resolveInRoot(root, path.Dir(name)+"/"+header.Linkname); err != nil {
+		return fmt.Errorf("symlink %s points to %s: %w", header.Name, header.Linkname, err)
+	}
+
+	return nil
+}
+
+// resolveInRoot resolves the symlinks in name, a slash separated path relative
+// to the root, and fails if it ever leaves the root. Path components that
+// don't exist are resolved lexically.
+func resolveInRoot(root *os.Root, name string) (string, error) {
+	var resolved []string
+	pending := strings.Split(name, "/")
+
+	for hops := 0; len(pending) > 0; {
+		part := pending[0]
+		pending = pending[1:]
+
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				return "", errors.New("path is outside of the OCI layout")
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+
+		current, err := filepath.Localize(path.Join(append(resolved, part)...))
+		if err != nil {
+			return "", errors.New("invalid or unsafe file path")
+		}
+
+		info, err := root.Lstat(current)
+		if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+			resolved = append(resolved, part)
+			continue
+		}
+
+		hops++
+		if hops > 255 {
+			return "", errors.New("too many levels of symbolic links")
+		}
+
+		target, err := root.Readlink(current)
+		if err != nil {
+			return "", err
+		}
+		target = filepath.ToSlash(target)
+		if path.IsAbs(target) {
+			return "", fmt.Errorf("path passes through symlink %s with absolute target %s", current, target)
+		}
+
+		pending = append(strings.Split(target, "/"), pending...)
+	}
+
+	return path.Join(resolved...), nil
+}
+
+// removeExisting removes the file at path, so a link can be created in its
+// place. Directories are not removed.
+func removeExisting(root *os.Root, path string) error {
+	info, err := root.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("could not replace directory %s by a link", path)
+	}
+	return root.Remove(path)
+}
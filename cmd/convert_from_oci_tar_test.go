@@ -0,0 +1,86 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveInRoot(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"store/sha256", "other"} {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"blobs":         "store",
+		"other/blobs":   "../store",
+		"other/up":      "../..",
+		"absolute":      "/etc",
+		"loop":          "loop",
+		"store/sha256a": "sha256",
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	tests := []struct {
+		name          string
+		expected      string
+		expectedError bool
+	}{
+		{name: "index.json", expected: "index.json"},
+		{name: "./store/sha256/abc", expected: "store/sha256/abc"},
+		{name: "blobs/sha256/abc", expected: "store/sha256/abc"},
+		{name: "other/blobs/sha256/abc", expected: "store/sha256/abc"},
+		{name: "blobs/sha256a/abc", expected: "store/sha256/abc"},
+		{name: "missing/../blobs", expected: "store"},
+		{name: "store/../..", expectedError: true},
+		{name: "other/up/x", expectedError: true},
+		{name: "absolute/passwd", expectedError: true},
+		{name: "loop/x", expectedError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resolved, err := resolveInRoot(root, test.name)
+			if test.expectedError {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", resolved)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resolved != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, resolved)
+			}
+		})
+	}
+}
@@ -17,7 +17,6 @@ limitations under the License.
 package cmd
 
 import (
-	"fmt"
 	"runtime"
 
 	"github.com/google/go-containerregistry/pkg/name"
@@ -34,6 +33,10 @@ var CommandConvertToDockerTar = cobra.Command{
 	Short: "Reads the OCI layout directory and outputs a tarball that is compatible with \"docker load\"",
 	Args:  cobra.ExactArgs(3),
 	Run: func(cmd *cobra.Command, args []string) {
+		if dryRun {
+			fail("--dry-run is not supported by convert-to-docker-tar")
+		}
+
 		path := args[0]
 		output := args[1]
 		imageName := args[2]
@@ -47,22 +50,9 @@ var CommandConvertToDockerTar = cobra.Command{
 		var images []v1.Image
 		err = pkg.SearchOCITree(index, nil,
 			func(descriptors []*v1.Descriptor, image v1.Image) error {
-				var platform *v1.Platform
-
-				for _, desc := range descriptors {
-					if desc.Platform != nil {
-						platform = desc.Platform
-					}
-				}
-
-				{
-					cfg, err := image.ConfigFile()
-					if err != nil {
-						return fmt.Errorf("could not load image config: %w", err)
-					}
-					if imgPlatform := cfg.Platform(); imgPlatform != nil {
-						platform = imgPlatform
-					}
+				platform, err := pkg.ImagePlatform(descriptors, image)
+				if err != nil {
+					return err
 				}
 
 				if platform != nil && platform.Architecture == runtime.GOARCH {
@@ -0,0 +1,396 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	pathpkg "path"
+	"slices"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/spf13/cobra"
+
+	"github.com/cert-manager/image-tool/pkg"
+)
+
+var (
+	copyFromPlatforms []string
+	copyFromSource    string
+	copyFromFlags     directoryLayerFlags
+	copyFromComp      compressionFlags
+	copyFromCreatedBy string
+	copyFromComment   string
+)
+
+func init() {
+	CommandCopyFrom.Flags().StringArrayVar(&copyFromPlatforms, "platform", nil, "only append the layer to images matching this platform (e.g. linux/arm64), can be repeated")
+	CommandCopyFrom.Flags().StringVar(&copyFromSource, "from", "", "OCI layout directory of the image the paths are copied from")
+	copyFromFlags.addFlags(CommandCopyFrom.Flags())
+	copyFromComp.addFlags(CommandCopyFrom.Flags())
+	CommandCopyFrom.Flags().StringVar(&copyFromCreatedBy, "created-by", "image-tool copy-from", "created_by recorded in the history entry of the appended layer")
+	CommandCopyFrom.Flags().StringVar(&copyFromComment, "comment", "", "comment recorded in the history entry of the appended layer, defaults to the source layout and the path mappings")
+}
+
+var CommandCopyFrom = cobra.Command{
+	Use:   "copy-from oci-layout-path --from source-layout src:dst[:mode]...",
+	Short: "Appends a layer with paths copied from the images in another OCI layout to every image in an OCI index",
+	Long: `Appends a layer with paths copied from the images in another OCI layout to
+every image in an OCI index, like a Dockerfile "COPY --from".
+
+For every image, the image with the same platform is looked up in the --from
+layout and its layers are flattened. Every src path of the flattened filesystem
+is copied to dst, directories are copied including their contents. Symlinks in
+src are resolved within the flattened filesystem (e.g. /bin/sh with
+/bin -> usr/bin). A dst ending with a slash places src in that directory under
+its own name. Missing parent directories are created, owned by root with mode
+0755. The optional octal mode replaces the mode of the copied regular files.
+
+The ownership of the copied files is set by --chown (root by default), like a
+Dockerfile COPY. Symlinks are copied as-is, hardlinks to files that are not
+copied are stored as regular files. The layer is deterministic and sorted by
+dst. Images with an unknown platform (like buildx attestations) are skipped.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		oci := args[0]
+		args = args[1:]
+
+		if len(args) == 0 {
+			return
+		}
+
+		if copyFromSource == "" {
+			fail("--from is required")
+		}
+
+		platforms := parsePlatforms(copyFromPlatforms)
+		options := copyFromFlags.options()
+		comp := copyFromComp.options(cmd.Flags())
+
+		mappings := make([]fileMapping, 0, len(args))
+		for _, arg := range args {
+			mapping := parseFileMapping(arg)
+			mapping.src = pkg.CleanEntryName(mapping.src)
+			mappings = append(mappings, mapping)
+		}
+
+		source := loadIndex(copyFromSource)
+
+		history := v1.History{
+			Created:   v1.Time{Time: sourceDateEpoch()},
+			CreatedBy: copyFromCreatedBy,
+			Comment:   copyFromComment,
+		}
+		if history.Comment == "" {
+			history.Comment = fmt.Sprintf("from %s: %s", copyFromSource, strings.Join(args, " "))
+		}
+
+		{
+			path, err := layout.FromPath(oci)
+			must("could not load oci directory", err)
+
+			index, err := path.ImageIndex()
+			must("could not load oci image index", err)
+
+			// Every source image is only flattened once, also when it matches
+			// multiple images
+			layers := map[v1.Hash]untypedLayer{}
+
+			index, err = appendPlatformLayers(index, platforms, comp, nil, func(platform *v1.Platform) ([]untypedLayer, error) {
+				if platform != nil && platform.OS == "unknown" {
+					return nil, nil
+				}
+
+				img, err := findPlatformImage(source, platform)
+				if err != nil {
+					return nil, fmt.Errorf("source: %w", err)
+				}
+
+				digest, err := img.Digest()
+				if err != nil {
+					return nil, fmt.Errorf("could not get source image digest: %w", err)
+				}
+
+				layer, ok := layers[digest]
+				if !ok {
+					layer, err = newUntypedLayerFromImage(img, mappings, options)
+					if err != nil {
+						return nil, fmt.Errorf("could not copy from source image for platform %q: %w", platform, err)
+					}
+
+					layer.history = history
+					layers[digest] = layer
+				}
+
+				return []untypedLayer{layer}, nil
+			})
+			must("could not modify oci tree", err)
+
+			options.checkXattrsUsed()
+
+			writeLayout(cmd.OutOrStdout(), oci, index)
+		}
+	},
+}
+
+// flatEntry is an entry of a flattened filesystem tarball, the contents of
+// regular files start at offset.
+type flatEntry struct {
+	header *tar.Header
+	offset int64
+}
+
+// copiedEntry is an entry of the flattened filesystem that is copied to dst.
+type copiedEntry struct {
+	name string
+	dst  string
+	opts directoryLayerOptions
+
+	// root is set for the src path of the mapping
+	root bool
+}
+
+// newUntypedLayerFromImage creates a layer with the paths of the mappings
+// copied from the flattened filesystem of the image.
+func newUntypedLayerFromImage(img v1.Image, mappings []fileMapping, opts directoryLayerOptions) (untypedLayer, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return untypedLayer{}, fmt.Errorf("could not get image layers: %w", err)
+	}
+
+	flat := newSpoolFile("flat-*.tar")
+	defer flat.Close()
+
+	bw := bufio.NewWriter(flat)
+	if err := pkg.SquashLayers(bw, layers, false); err != nil {
+		return untypedLayer{}, fmt.Errorf("could not flatten image: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return untypedLayer{}, fmt.Errorf("could not write flattened image: %w", err)
+	}
+
+	entries, names, err := indexFlatTarball(flat)
+	if err != nil {
+		return untypedLayer{}, err
+	}
+
+	var copied []copiedEntry
+	for _, mapping := range mappings {
+		mappingOpts := opts
+		if mapping.hasMode {
+			mappingOpts.fileMode = mapping.mode
+			mappingOpts.overrideFileMode = true
+		}
+
+		// Symlinks in src are followed, like a Dockerfile "COPY --from"
+		src, err := resolveFlatPath(entries, mapping.src)
+		if err != nil {
+			return untypedLayer{}, err
+		}
+
+		found := false
+		for _, name := range names {
+			rel, ok := strings.CutPrefix(name, src)
+			if src != "." && (!ok || (rel != "" && !strings.HasPrefix(rel, "/"))) {
+				continue
+			}
+			if src == "." {
+				rel = name
+				if rel == "." {
+					rel = ""
+				}
+			}
+
+			found = true
+			copied = append(copied, copiedEntry{
+				name: name,
+				dst:  normalizeEntryName(pathpkg.Join(mapping.dst, rel), false),
+				opts: mappingOpts,
+				root: rel == "",
+			})
+		}
+
+		if !found {
+			return untypedLayer{}, fmt.Errorf("path %q does not exist in the source image", "/"+mapping.src)
+		}
+	}
+
+	slices.SortStableFunc(copied, func(a, b copiedEntry) int {
+		return strings.Compare(a.dst, b.dst)
+	})
+
+	spool := newSpoolFile("copy-*.tar")
+	defer spool.Close()
+
+	lbw := bufio.NewWriter(spool)
+	lw := newLayerWriter(lbw)
+
+	// copiedTo records where a source file was copied to, so hardlinks to
+	// it can be kept
+	copiedTo := map[string]string{}
+
+	for _, entry := range copied {
+		source := entries[entry.name]
+		header := *source.header
+
+		var contents io.Reader
+		switch header.Typeflag {
+		case tar.TypeReg:
+			contents = io.NewSectionReader(flat, source.offset, header.Size)
+			copiedTo[entry.name] = entry.dst
+		case tar.TypeLink:
+			target := pkg.CleanEntryName(header.Linkname)
+			if dst, ok := copiedTo[target]; ok {
+				header.Linkname = dst
+				break
+			}
+
+			// The link target is not part of the layer, so the file is
+			// stored as a regular file
+			targetEntry, ok := entries[target]
+			if !ok || targetEntry.header.Typeflag != tar.TypeReg {
+				return untypedLayer{}, fmt.Errorf("hardlink %q points to %q, which is not a regular file", "/"+entry.name, "/"+target)
+			}
+
+			header = *targetEntry.header
+			contents = io.NewSectionReader(flat, targetEntry.offset, header.Size)
+			copiedTo[target] = entry.dst
+		}
+
+		xattrs := map[string]string{}
+		for key, value := range header.PAXRecords {
+			if name, ok := strings.CutPrefix(key, paxXattrPrefix); ok {
+				xattrs[name] = value
+			}
+		}
+
+		if err := lw.writeParents(entry.dst, entry.opts); err != nil {
+			return untypedLayer{}, err
+		}
+
+		// A copied directory is written like the parents of dst, so the
+		// owner and mode of the source directory don't leak into dst
+		if entry.root && header.Typeflag == tar.TypeDir {
+			if err := lw.writeDir(entry.dst, xattrs, entry.opts); err != nil {
+				return untypedLayer{}, err
+			}
+			continue
+		}
+
+		if err := lw.writeEntry(&header, entry.dst, xattrs, contents, entry.opts); err != nil {
+			return untypedLayer{}, err
+		}
+	}
+
+	if err := lw.close(); err != nil {
+		return untypedLayer{}, fmt.Errorf("could not write tarball: %w", err)
+	}
+	if err := lbw.Flush(); err != nil {
+		return untypedLayer{}, fmt.Errorf("could not write tarball: %w", err)
+	}
+	if err := spool.Close(); err != nil {
+		return untypedLayer{}, fmt.Errorf("could not write tarball: %w", err)
+	}
+
+	return newUntypedLayer(fileOpener(spool.Name())), nil
+}
+
+// resolveFlatPath resolves the symlinks in name within the flattened
+// filesystem. Absolute link targets are relative to the image root and ".."
+// never leaves the root, like in a container.
+func resolveFlatPath(entries map[string]flatEntry, name string) (string, error) {
+	var resolved []string
+	pending := strings.Split(name, "/")
+
+	for hops := 0; len(pending) > 0; {
+		part := pending[0]
+		pending = pending[1:]
+
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) > 0 {
+				resolved = resolved[:len(resolved)-1]
+			}
+			continue
+		}
+
+		current := pathpkg.Join(pathpkg.Join(resolved...), part)
+		entry, ok := entries[current]
+		if !ok || entry.header.Typeflag != tar.TypeSymlink {
+			resolved = append(resolved, part)
+			continue
+		}
+
+		hops++
+		if hops > 255 {
+			return "", fmt.Errorf("too many levels of symbolic links in %q", "/"+name)
+		}
+
+		if pathpkg.IsAbs(entry.header.Linkname) {
+			resolved = nil
+		}
+		pending = append(strings.Split(entry.header.Linkname, "/"), pending...)
+	}
+
+	if len(resolved) == 0 {
+		return ".", nil
+	}
+	return pathpkg.Join(resolved...), nil
+}
+
+// indexFlatTarball returns the entries of the tarball by name and the names
+// in tarball order. The contents are skipped, their offset is recorded so
+// they can be read later.
+func indexFlatTarball(flat *os.File) (map[string]flatEntry, []string, error) {
+	if _, err := flat.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, fmt.Errorf("could not read flattened image: %w", err)
+	}
+
+	entries := map[string]flatEntry{}
+	var names []string
+
+	tr := tar.NewReader(flat)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not read flattened image: %w", err)
+		}
+
+		// The tar reader doesn't read ahead, so the file position is the
+		// start of the contents
+		offset, err := flat.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not read flattened image: %w", err)
+		}
+
+		name := pkg.CleanEntryName(header.Name)
+		entries[name] = flatEntry{header: header, offset: offset}
+		names = append(names, name)
+	}
+
+	return entries, names, nil
+}
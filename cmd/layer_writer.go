@@ -0,0 +1,249 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strings"
+)
+
+// layerWriter writes files and directories from disk as tar entries of a
+// deterministic layer.
+type layerWriter struct {
+	tw *tar.Writer
+
+	// Files with multiple links are written once, later paths that link
+	// to the same file are written as hardlinks to the first path
+	hardlinks map[fileID]string
+
+	// written records the names of the entries that were written (as
+	// returned by normalizeEntryName for non-directories)
+	written map[string]bool
+}
+
+func newLayerWriter(w io.Writer) *layerWriter {
+	return &layerWriter{
+		tw:        tar.NewWriter(w),
+		hardlinks: map[fileID]string{},
+		written:   map[string]bool{},
+	}
+}
+
+func (lw *layerWriter) close() error {
+	return lw.tw.Close()
+}
+
+// writeParents writes the parent directories of entryName that were not
+// written yet. Parent directories are always owned by root, so existing
+// directories in the image (like /usr) don't change owner.
+func (lw *layerWriter) writeParents(entryName string, opts directoryLayerOptions) error {
+	entryName = normalizeEntryName(entryName, false)
+	if entryName == "." {
+		return nil
+	}
+
+	parents := strings.Split(entryName, "/")
+	for i := range len(parents) - 1 {
+		if err := lw.writeDir(strings.Join(parents[:i+1], "/"), nil, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDir writes a directory entry that is owned by root with mode 0755, so
+// existing directories in the image (like /usr or the image root) keep an
+// owner and mode that every user can traverse. Directories that were already
+// written are skipped.
+func (lw *layerWriter) writeDir(entryName string, xattrs map[string]string, opts directoryLayerOptions) error {
+	entryName = normalizeEntryName(entryName, false)
+	if lw.written[entryName] {
+		return nil
+	}
+
+	err := opts.writeHeader(lw.tw, &tar.Header{
+		Typeflag:   tar.TypeDir,
+		Name:       entryName,
+		Mode:       0755,
+		PAXRecords: opts.xattrRecords(entryName, xattrs),
+	})
+	if err != nil {
+		return err
+	}
+
+	lw.written[entryName] = true
+	return nil
+}
+
+// writeTree writes the file, symlink or directory at path as entryName,
+// directories are written including all their contents. The parent
+// directories of entryName must be written first. A directory at path is
+// written with writeDir, so the mode and owner on disk don't leak into
+// entryName itself. A symlink at path is resolved first, only symlinks inside
+// the tree are recorded as symlinks.
+func (lw *layerWriter) writeTree(path string, entryName string, opts directoryLayerOptions) error {
+	// filepath.Walk doesn't descend into a symlinked root, which would
+	// replace entryName by a symlink to a path on the host
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fmt.Errorf("could not resolve symlink: %w", err)
+	}
+
+	parent := filepath.Dir(path)
+
+	root, err := os.OpenRoot(parent)
+	if err != nil {
+		return fmt.Errorf("could not open root directory: %w", err)
+	}
+	defer root.Close()
+
+	return filepath.Walk(path, func(target string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("walk error: %w", err)
+		}
+
+		// Sockets can't be stored in a tarball
+		if info.Mode()&fs.ModeSocket != 0 {
+			return fmt.Errorf("%q is a socket, which can't be stored in a layer", target)
+		}
+
+		name, err := filepath.Rel(parent, target)
+		if err != nil {
+			return fmt.Errorf("could not build relative path: %w", err)
+		}
+
+		rel, err := filepath.Rel(path, target)
+		if err != nil {
+			return fmt.Errorf("could not build relative path: %w", err)
+		}
+
+		targetEntryName := normalizeEntryName(pathpkg.Join(entryName, filepath.ToSlash(rel)), false)
+
+		// Symlinks are never followed, the link target is recorded as-is
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			link, err = root.Readlink(name)
+			if err != nil {
+				return fmt.Errorf("could not read symlink %q: %w", target, err)
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return fmt.Errorf("could not create tar header for %q: %w", target, err)
+		}
+
+		if header.Typeflag == tar.TypeReg {
+			if id, ok := hardlinkID(info); ok {
+				if linkName, seen := lw.hardlinks[id]; seen {
+					header.Typeflag = tar.TypeLink
+					header.Linkname = linkName
+					header.Size = 0
+				} else {
+					lw.hardlinks[id] = targetEntryName
+				}
+			}
+		}
+
+		var source map[string]string
+		if opts.preserveXattrs && header.Typeflag != tar.TypeLink && header.Typeflag != tar.TypeSymlink {
+			source, err = readXattrs(target)
+			if err != nil {
+				return fmt.Errorf("could not read extended attributes of %q: %w", target, err)
+			}
+		}
+
+		if rel == "." && header.Typeflag == tar.TypeDir {
+			return lw.writeDir(targetEntryName, source, opts)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			return lw.writeEntry(header, targetEntryName, source, nil, opts)
+		}
+
+		file, err := root.Open(name)
+		if err != nil {
+			return fmt.Errorf("could not write tar contents: %w", err)
+		}
+		defer file.Close()
+
+		return lw.writeEntry(header, targetEntryName, source, file, opts)
+	})
+}
+
+// writeEntry writes a tar entry named entryName, using the type, mode, link
+// and device fields of the header. All fields that would make the layer
+// non-reproducible are dropped. The extended attributes of the source file
+// are combined with the configured attributes. Directories that were already
+// written are skipped, any other entry may only be written once.
+func (lw *layerWriter) writeEntry(header *tar.Header, entryName string, xattrs map[string]string, contents io.Reader, opts directoryLayerOptions) error {
+	entryName = normalizeEntryName(entryName, false)
+
+	if entryName == "." && header.Typeflag != tar.TypeDir {
+		return errors.New("the image root can only be replaced by a directory")
+	}
+
+	if lw.written[entryName] {
+		if header.Typeflag == tar.TypeDir {
+			return nil
+		}
+		return fmt.Errorf("%q is already in the layer", "/"+entryName)
+	}
+
+	simplified := &tar.Header{
+		Typeflag: header.Typeflag,
+		Name:     entryName,
+		Mode:     header.Mode,
+		Linkname: header.Linkname,
+		Size:     header.Size,
+		Devmajor: header.Devmajor,
+		Devminor: header.Devminor,
+	}
+
+	// Extended attributes (including file capabilities) belong to the
+	// file, so they are not repeated for hardlinks and can't be configured
+	// for a hardlink, the file was already written. Symlinks can't have
+	// user attributes and are skipped.
+	if _, ok := opts.xattrs[entryName]; ok && simplified.Typeflag == tar.TypeLink {
+		return fmt.Errorf("extended attributes can't be set on %q, it is a hardlink to %q, set them on %q instead", "/"+entryName, "/"+simplified.Linkname, "/"+simplified.Linkname)
+	}
+	if simplified.Typeflag != tar.TypeLink && simplified.Typeflag != tar.TypeSymlink {
+		simplified.PAXRecords = opts.xattrRecords(entryName, xattrs)
+	}
+
+	opts.normalizeHeader(simplified)
+
+	if err := opts.writeHeader(lw.tw, simplified); err != nil {
+		return err
+	}
+	lw.written[entryName] = true
+
+	if simplified.Typeflag == tar.TypeReg {
+		if _, err := io.Copy(lw.tw, contents); err != nil {
+			return fmt.Errorf("could not write tar contents: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,372 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/cert-manager/image-tool/pkg"
+)
+
+var (
+	mutateConfigPlatforms []string
+	mutateConfigFlags     configFlags
+)
+
+func init() {
+	CommandMutateConfig.Flags().StringArrayVar(&mutateConfigPlatforms, "platform", nil, "only mutate the config of images matching this platform (e.g. linux/arm64), can be repeated")
+	mutateConfigFlags.addFlags(CommandMutateConfig.Flags())
+}
+
+var CommandMutateConfig = cobra.Command{
+	Use:   "mutate-config oci-layout-path",
+	Short: "Changes the entrypoint, cmd, env, user, workdir, ports, volumes and stop signal of every image in an OCI index",
+	Long: `Changes the entrypoint, cmd, env, user, workdir, ports, volumes and stop
+signal in the config of every image in an OCI index.
+
+Only the fields for which a flag is passed are changed. --entrypoint and --cmd
+take a JSON array (e.g. '["/app", "--flag"]'), any other value is used as a
+single argument. Unlike a Dockerfile ENTRYPOINT, setting the entrypoint does
+not reset the cmd.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		oci := args[0]
+
+		platforms := parsePlatforms(mutateConfigPlatforms)
+		mutation := mutateConfigFlags.options(cmd.Flags())
+
+		{
+			path, err := layout.FromPath(oci)
+			must("could not load oci directory", err)
+
+			index, err := path.ImageIndex()
+			must("could not load oci image index", err)
+
+			err = checkPlatformsMatch(index, nil, platforms)
+			must("invalid --platform", err)
+
+			index, err = pkg.MutateOCITreeWithDescriptors(
+				index, nil,
+				func(descriptors []*v1.Descriptor, image v1.Image) (v1.Image, error) {
+					platform, err := pkg.ImagePlatform(descriptors, image)
+					if err != nil {
+						return nil, err
+					}
+
+					if !pkg.MatchesPlatform(platform, platforms) {
+						return image, nil
+					}
+
+					configFile, err := image.ConfigFile()
+					if err != nil {
+						return nil, fmt.Errorf("could not parse config file: %w", err)
+					}
+
+					configFile = configFile.DeepCopy()
+					mutation.apply(&configFile.Config)
+
+					image, err = mutate.ConfigFile(image, configFile)
+					if err != nil {
+						return nil, fmt.Errorf("could not replace config file: %w", err)
+					}
+
+					return image, nil
+				},
+				nil,
+			)
+			must("could not modify oci tree", err)
+
+			writeLayout(cmd.OutOrStdout(), oci, index)
+		}
+	},
+}
+
+// configFlags holds the unparsed command line flags that change the image
+// config.
+type configFlags struct {
+	entrypoint       string
+	appendEntrypoint []string
+	cmd              string
+	appendCmd        []string
+
+	// env holds the --env, --append-env and --unset-env values in command
+	// line order
+	env []envFlagValue
+
+	user       string
+	workdir    string
+	stopSignal string
+
+	expose            []string
+	resetExposedPorts bool
+	volumes           []string
+	resetVolumes      bool
+}
+
+func (f *configFlags) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&f.entrypoint, "entrypoint", "", "replace the entrypoint, a JSON array or a single argument ('[]' removes the entrypoint)")
+	flags.StringArrayVar(&f.appendEntrypoint, "append-entrypoint", nil, "append an argument to the entrypoint, can be repeated")
+	flags.StringVar(&f.cmd, "cmd", "", "replace the cmd, a JSON array or a single argument ('[]' removes the cmd)")
+	flags.StringArrayVar(&f.appendCmd, "append-cmd", nil, "append an argument to the cmd, can be repeated")
+	flags.Var(envFlag{name: "env", values: &f.env}, "env", "KEY=VALUE environment variable to set, replaces an existing value, can be repeated")
+	flags.Var(envFlag{name: "append-env", values: &f.env}, "append-env", "KEY=VALUE appended to an existing environment variable with a ':' separator (e.g. PATH=/opt/bin), can be repeated")
+	flags.Var(envFlag{name: "unset-env", values: &f.env}, "unset-env", "KEY of an environment variable to remove, can be repeated")
+	flags.StringVar(&f.user, "user", "", "user[:group] the image runs as")
+	flags.StringVar(&f.workdir, "workdir", "", "working directory of the image")
+	flags.StringVar(&f.stopSignal, "stop-signal", "", "signal that stops the container (e.g. SIGTERM)")
+	flags.StringArrayVar(&f.expose, "expose", nil, "port[/protocol] to expose, the protocol defaults to tcp, can be repeated")
+	flags.BoolVar(&f.resetExposedPorts, "reset-exposed-ports", false, "remove all exposed ports before adding the --expose ports")
+	flags.StringArrayVar(&f.volumes, "volume", nil, "path of a volume to add, can be repeated")
+	flags.BoolVar(&f.resetVolumes, "reset-volumes", false, "remove all volumes before adding the --volume paths")
+}
+
+func (f *configFlags) options(flags *pflag.FlagSet) configMutation {
+	var m configMutation
+
+	if flags.Changed("entrypoint") {
+		m.entrypoint = parseCommandFlag("invalid --entrypoint", f.entrypoint)
+		m.setEntrypoint = true
+	}
+	m.appendEntrypoint = f.appendEntrypoint
+
+	if flags.Changed("cmd") {
+		m.cmd = parseCommandFlag("invalid --cmd", f.cmd)
+		m.setCmd = true
+	}
+	m.appendCmd = f.appendCmd
+
+	for _, env := range f.env {
+		switch env.name {
+		case "env":
+			key, value := parseEnvFlag("invalid --env", env.value)
+			m.env = append(m.env, envChange{key: key, value: value})
+		case "append-env":
+			key, value := parseEnvFlag("invalid --append-env", env.value)
+			m.env = append(m.env, envChange{key: key, value: value, append: true})
+		case "unset-env":
+			key := env.value
+			if key == "" || strings.Contains(key, "=") {
+				fail("invalid --unset-env: %q is not a variable name", key)
+			}
+			m.env = append(m.env, envChange{key: key, unset: true})
+		}
+	}
+
+	if flags.Changed("user") {
+		m.user = &f.user
+	}
+	if flags.Changed("workdir") {
+		if f.workdir != "" && !strings.HasPrefix(f.workdir, "/") {
+			fail("invalid --workdir: %q must be an absolute path", f.workdir)
+		}
+		m.workdir = &f.workdir
+	}
+	if flags.Changed("stop-signal") {
+		m.stopSignal = &f.stopSignal
+	}
+
+	for _, port := range f.expose {
+		m.expose = append(m.expose, parsePortFlag(port))
+	}
+	m.resetExposedPorts = f.resetExposedPorts
+
+	for _, volume := range f.volumes {
+		if !strings.HasPrefix(volume, "/") {
+			fail("invalid --volume: %q must be an absolute path", volume)
+		}
+		m.volumes = append(m.volumes, volume)
+	}
+	m.resetVolumes = f.resetVolumes
+
+	return m
+}
+
+// parseCommandFlag parses a JSON array of arguments, any other value is a
+// single argument.
+func parseCommandFlag(msg string, value string) []string {
+	if !strings.HasPrefix(strings.TrimSpace(value), "[") {
+		return []string{value}
+	}
+
+	var command []string
+	must(msg, json.Unmarshal([]byte(value), &command))
+	return command
+}
+
+func parseEnvFlag(msg string, env string) (string, string) {
+	key, value, found := strings.Cut(env, "=")
+	if !found || key == "" {
+		fail("%s: %q must have the form KEY=VALUE", msg, env)
+	}
+	return key, value
+}
+
+// parsePortFlag returns the port in the "port/protocol" form used by the
+// image config.
+func parsePortFlag(port string) string {
+	number, protocol, found := strings.Cut(port, "/")
+	if !found {
+		protocol = "tcp"
+	}
+
+	value, err := strconv.ParseUint(number, 10, 16)
+	if err != nil || value == 0 {
+		fail("invalid --expose: %q is not a valid port", port)
+	}
+
+	protocol = strings.ToLower(protocol)
+	if !slices.Contains([]string{"tcp", "udp", "sctp"}, protocol) {
+		fail("invalid --expose: %q has unknown protocol %q, must be tcp, udp or sctp", port, protocol)
+	}
+
+	return fmt.Sprintf("%d/%s", value, protocol)
+}
+
+// envFlagValue is a value of one of the env flags.
+type envFlagValue struct {
+	name  string
+	value string
+}
+
+// envFlag is a repeatable flag that records its values in a list shared by
+// all env flags, so the env changes keep their command line order (e.g.
+// --unset-env A --env A=1 sets A).
+type envFlag struct {
+	name   string
+	values *[]envFlagValue
+}
+
+func (f envFlag) String() string {
+	return ""
+}
+
+func (f envFlag) Set(value string) error {
+	*f.values = append(*f.values, envFlagValue{name: f.name, value: value})
+	return nil
+}
+
+func (f envFlag) Type() string {
+	return "stringArray"
+}
+
+type envChange struct {
+	key    string
+	value  string
+	append bool
+	unset  bool
+}
+
+// configMutation describes the changes to the image config, fields that are
+// not set are left unchanged.
+type configMutation struct {
+	entrypoint       []string
+	setEntrypoint    bool
+	appendEntrypoint []string
+	cmd              []string
+	setCmd           bool
+	appendCmd        []string
+
+	// env changes are applied in command line order
+	env []envChange
+
+	user       *string
+	workdir    *string
+	stopSignal *string
+
+	expose            []string
+	resetExposedPorts bool
+	volumes           []string
+	resetVolumes      bool
+}
+
+func (m configMutation) apply(config *v1.Config) {
+	if m.setEntrypoint {
+		config.Entrypoint = slices.Clone(m.entrypoint)
+	}
+	config.Entrypoint = append(config.Entrypoint, m.appendEntrypoint...)
+
+	if m.setCmd {
+		config.Cmd = slices.Clone(m.cmd)
+	}
+	config.Cmd = append(config.Cmd, m.appendCmd...)
+
+	for _, change := range m.env {
+		config.Env = applyEnvChange(config.Env, change)
+	}
+
+	if m.user != nil {
+		config.User = *m.user
+	}
+	if m.workdir != nil {
+		config.WorkingDir = *m.workdir
+	}
+	if m.stopSignal != nil {
+		config.StopSignal = *m.stopSignal
+	}
+
+	if m.resetExposedPorts {
+		config.ExposedPorts = nil
+	}
+	for _, port := range m.expose {
+		if config.ExposedPorts == nil {
+			config.ExposedPorts = map[string]struct{}{}
+		}
+		config.ExposedPorts[port] = struct{}{}
+	}
+
+	if m.resetVolumes {
+		config.Volumes = nil
+	}
+	for _, volume := range m.volumes {
+		if config.Volumes == nil {
+			config.Volumes = map[string]struct{}{}
+		}
+		config.Volumes[volume] = struct{}{}
+	}
+}
+
+func applyEnvChange(env []string, change envChange) []string {
+	idx := slices.IndexFunc(env, func(entry string) bool {
+		key, _, _ := strings.Cut(entry, "=")
+		return key == change.key
+	})
+
+	switch {
+	case change.unset:
+		if idx >= 0 {
+			env = slices.Delete(env, idx, idx+1)
+		}
+	case idx < 0:
+		env = append(env, change.key+"="+change.value)
+	case change.append:
+		env[idx] += ":" + change.value
+	default:
+		env[idx] = change.key + "=" + change.value
+	}
+
+	return env
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"slices"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+
+	"github.com/cert-manager/image-tool/pkg"
+)
+
+func parsePlatforms(specs []string) []v1.Platform {
+	platforms := make([]v1.Platform, 0, len(specs))
+	for _, spec := range specs {
+		platform, err := v1.ParsePlatform(spec)
+		must("invalid platform", err)
+
+		platforms = append(platforms, *platform)
+	}
+	return platforms
+}
+
+func loadIndex(oci string) v1.ImageIndex {
+	path, err := layout.FromPath(oci)
+	must("could not load oci directory", err)
+
+	index, err := path.ImageIndex()
+	must("could not load oci image index", err)
+
+	return index
+}
+
+// checkPlatformsMatch fails if one of the platforms doesn't match any image in
+// the OCI tree that matches the filter, so a typo in a platform fails instead
+// of silently leaving the images unchanged. An empty filter matches every
+// image.
+func checkPlatformsMatch(index v1.ImageIndex, filter []v1.Platform, platforms []v1.Platform) error {
+	if len(platforms) == 0 {
+		return nil
+	}
+
+	var found []*v1.Platform
+	err := pkg.SearchOCITree(index, nil, func(descriptors []*v1.Descriptor, img v1.Image) error {
+		imgPlatform, err := pkg.ImagePlatform(descriptors, img)
+		if err != nil {
+			return err
+		}
+
+		if imgPlatform != nil && pkg.MatchesPlatform(imgPlatform, filter) {
+			found = append(found, imgPlatform)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, platform := range platforms {
+		if !slices.ContainsFunc(found, func(imgPlatform *v1.Platform) bool {
+			return pkg.MatchesPlatform(imgPlatform, []v1.Platform{platform})
+		}) {
+			names := make([]string, 0, len(found))
+			for _, imgPlatform := range found {
+				names = append(names, imgPlatform.String())
+			}
+			return fmt.Errorf("no image found for platform %q, found platforms %q", platform.String(), names)
+		}
+	}
+
+	return nil
+}
+
+// findPlatformImage returns the only image in the OCI tree that has the given
+// platform. If platform is nil, the tree must contain a single image.
+func findPlatformImage(index v1.ImageIndex, platform *v1.Platform) (v1.Image, error) {
+	var images []v1.Image
+	var found []string
+
+	err := pkg.SearchOCITree(index, nil, func(descriptors []*v1.Descriptor, img v1.Image) error {
+		imgPlatform, err := pkg.ImagePlatform(descriptors, img)
+		if err != nil {
+			return err
+		}
+
+		if imgPlatform != nil {
+			found = append(found, imgPlatform.String())
+		}
+
+		if platform != nil && (imgPlatform == nil || !imgPlatform.Satisfies(v1.Platform{
+			OS:           platform.OS,
+			Architecture: platform.Architecture,
+			Variant:      platform.Variant,
+			OSVersion:    platform.OSVersion,
+		})) {
+			return nil
+		}
+
+		images = append(images, img)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(images) == 1:
+		return images[0], nil
+	case platform == nil:
+		return nil, fmt.Errorf("the image has no platform, so the layout must contain exactly one image, found %d", len(images))
+	case len(images) == 0:
+		return nil, fmt.Errorf("no image found for platform %q, found platforms %q", platform, found)
+	default:
+		return nil, fmt.Errorf("found %d images for platform %q", len(images), platform)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/spf13/cobra"
+
+	"github.com/cert-manager/image-tool/pkg"
+)
+
+var (
+	rebasePlatforms []string
+	rebaseOldBase   string
+	rebaseNewBase   string
+)
+
+func init() {
+	CommandRebase.Flags().StringArrayVar(&rebasePlatforms, "platform", nil, "only rebase images matching this platform (e.g. linux/arm64), can be repeated")
+	CommandRebase.Flags().StringVar(&rebaseOldBase, "old-base", "", "OCI layout directory of the base image the images are currently based on")
+	CommandRebase.Flags().StringVar(&rebaseNewBase, "new-base", "", "OCI layout directory of the base image to rebase the images on")
+}
+
+var CommandRebase = cobra.Command{
+	Use:   "rebase oci-layout-path --old-base old-layout --new-base new-layout",
+	Short: "Replaces the base image layers of every image in an OCI index",
+	Long: `Replaces the base image layers of every image in an OCI index.
+
+For every image, the image with the same platform is looked up in the old and
+new base layouts. The bottom layers of the image must match the layers of the
+old base (by diff_id), they are replaced by the layers of the new base and the
+history of the old base is replaced by the history of the new base.
+
+Config fields that the image inherited unchanged from the old base (e.g. the
+user or an environment variable) are taken from the new base, fields that the
+image changed are kept. Env, labels, exposed ports and volumes are merged per
+key. Images with an unknown platform (like buildx attestations) are skipped.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		oci := args[0]
+
+		if rebaseOldBase == "" || rebaseNewBase == "" {
+			fail("--old-base and --new-base are required")
+		}
+
+		platforms := parsePlatforms(rebasePlatforms)
+
+		oldBase := loadIndex(rebaseOldBase)
+		newBase := loadIndex(rebaseNewBase)
+
+		{
+			path, err := layout.FromPath(oci)
+			must("could not load oci directory", err)
+
+			index, err := path.ImageIndex()
+			must("could not load oci image index", err)
+
+			err = checkPlatformsMatch(index, nil, platforms)
+			must("invalid --platform", err)
+
+			index, err = pkg.MutateOCITreeWithDescriptors(
+				index, nil,
+				func(descriptors []*v1.Descriptor, img v1.Image) (v1.Image, error) {
+					platform, err := pkg.ImagePlatform(descriptors, img)
+					if err != nil {
+						return nil, err
+					}
+
+					if !pkg.MatchesPlatform(platform, platforms) {
+						return img, nil
+					}
+
+					if platform != nil && platform.OS == "unknown" {
+						return img, nil
+					}
+
+					oldBaseImg, err := findPlatformImage(oldBase, platform)
+					if err != nil {
+						return nil, fmt.Errorf("old base: %w", err)
+					}
+
+					newBaseImg, err := findPlatformImage(newBase, platform)
+					if err != nil {
+						return nil, fmt.Errorf("new base: %w", err)
+					}
+
+					img, err = pkg.Rebase(img, oldBaseImg, newBaseImg)
+					if err != nil {
+						return nil, fmt.Errorf("could not rebase image for platform %q: %w", platform, err)
+					}
+
+					return img, nil
+				},
+				nil,
+			)
+			must("could not modify oci tree", err)
+
+			writeLayout(cmd.OutOrStdout(), oci, index)
+		}
+	},
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/spf13/cobra"
+
+	"github.com/cert-manager/image-tool/pkg"
+)
+
+var (
+	removePathsPlatforms []string
+	removePathsComp      compressionFlags
+)
+
+func init() {
+	CommandRemovePaths.Flags().StringArrayVar(&removePathsPlatforms, "platform", nil, "only remove paths from images matching this platform (e.g. linux/arm64), can be repeated")
+	removePathsComp.addFlags(CommandRemovePaths.Flags())
+}
+
+var CommandRemovePaths = cobra.Command{
+	Use:   "remove-paths oci-layout-path /path...",
+	Short: "Appends a layer that removes the paths from every image in an OCI index",
+	Long: `Appends a layer of OCI whiteout entries that removes the paths from every
+image in an OCI index.
+
+A path is removed including all its contents (using a ".wh.<name>" entry). A
+path that ends with a slash (e.g. /usr/share/doc/) only removes the contents of
+the directory and keeps the directory itself (using a ".wh..wh..opq" entry).`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		oci := args[0]
+		paths := args[1:]
+
+		if len(paths) == 0 {
+			return
+		}
+
+		platforms := parsePlatforms(removePathsPlatforms)
+		comp := removePathsComp.options(cmd.Flags())
+
+		{
+			path, err := layout.FromPath(oci)
+			must("could not load oci directory", err)
+
+			index, err := path.ImageIndex()
+			must("could not load oci image index", err)
+
+			layer := newWhiteoutLayer(paths)
+			layer.history = v1.History{
+				Created:   v1.Time{Time: sourceDateEpoch()},
+				CreatedBy: "image-tool remove-paths",
+				Comment:   "removed " + strings.Join(paths, ", "),
+			}
+
+			layers := []untypedLayer{layer}
+
+			index, err = appendUntypedLayers(index, platforms, comp, layers, nil)
+			must("could not modify oci tree", err)
+
+			writeLayout(cmd.OutOrStdout(), oci, index)
+		}
+	},
+}
+
+// whiteoutEntryName returns the name of the whiteout entry that removes the
+// path, or the opaque whiteout entry for paths that end with a slash.
+func whiteoutEntryName(target string) (string, error) {
+	opaque := strings.HasSuffix(target, "/")
+
+	cleaned := strings.TrimPrefix(path.Clean("/"+target), "/")
+	if cleaned == "" {
+		return "", fmt.Errorf("cannot remove the image root %q", target)
+	}
+
+	if opaque {
+		return path.Join(cleaned, pkg.WhiteoutOpaque), nil
+	}
+
+	dir, name := path.Split(cleaned)
+	if strings.HasPrefix(name, pkg.WhiteoutPrefix) {
+		return "", fmt.Errorf("cannot remove %q: names starting with %q are reserved for whiteouts", target, pkg.WhiteoutPrefix)
+	}
+
+	return path.Join(dir, pkg.WhiteoutPrefix+name), nil
+}
+
+func newWhiteoutLayer(paths []string) untypedLayer {
+	opts := directoryLayerOptions{modTime: sourceDateEpoch()}
+
+	names := make([]string, 0, len(paths))
+	for _, target := range paths {
+		name, err := whiteoutEntryName(target)
+		must("invalid path", err)
+
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		err := opts.writeHeader(tw, &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+		})
+		must("could not write whiteout tarball", err)
+	}
+	must("could not write whiteout tarball", tw.Close())
+
+	byts := buf.Bytes()
+
+	return newUntypedLayer(
+		func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(byts)), nil
+		},
+	)
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import "testing"
+
+func TestWhiteoutEntryName(t *testing.T) {
+	tests := []struct {
+		target        string
+		expected      string
+		expectedError bool
+	}{
+		{target: "/etc/passwd", expected: "etc/.wh.passwd"},
+		{target: "etc/passwd", expected: "etc/.wh.passwd"},
+		{target: "/bin", expected: ".wh.bin"},
+		{target: "/usr/share/doc/", expected: "usr/share/doc/.wh..wh..opq"},
+		{target: "/etc/../var/./cache", expected: "var/.wh.cache"},
+		{target: "/../../etc/passwd", expected: "etc/.wh.passwd"},
+		{target: "/", expectedError: true},
+		{target: "", expectedError: true},
+		{target: "/etc/.wh.passwd", expectedError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			name, err := whiteoutEntryName(test.target)
+			if test.expectedError {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if name != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, name)
+			}
+		})
+	}
+}
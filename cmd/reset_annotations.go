@@ -18,22 +18,54 @@ package cmd
 
 import (
 	"fmt"
+	"maps"
+	"regexp"
+	"strings"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/cert-manager/image-tool/pkg"
 )
 
+var (
+	resetLabelsFlags                annotationFilterFlags
+	resetImageAnnotationsFlags      annotationFilterFlags
+	resetIndexAnnotationsFlags      annotationFilterFlags
+	resetDescriptorAnnotationsFlags annotationFilterFlags
+)
+
+func init() {
+	resetLabelsFlags.addFlags(CommandResetLabelsAndAnnotations.Flags(), "label", "config labels")
+	resetImageAnnotationsFlags.addFlags(CommandResetLabelsAndAnnotations.Flags(), "image-annotation", "image manifest annotations")
+	resetIndexAnnotationsFlags.addFlags(CommandResetLabelsAndAnnotations.Flags(), "index-annotation", "index annotations")
+	resetDescriptorAnnotationsFlags.addFlags(CommandResetLabelsAndAnnotations.Flags(), "descriptor-annotation", "annotations on the descriptors in indices")
+}
+
 var CommandResetLabelsAndAnnotations = cobra.Command{
 	Use:   "reset-labels-and-annotations oci-layout-path",
 	Short: "Removes all labels and annotations from OCI indices, images and descriptors in a OCI layout directory",
-	Args:  cobra.ExactArgs(1),
+	Long: `Removes all labels and annotations from OCI indices, images and descriptors in
+a OCI layout directory.
+
+The --keep-* and --drop-* flags take glob patterns ("*" matches any sequence
+of characters, including "/", and "?" matches a single character) and limit
+which keys are removed. A key is removed if it matches a --drop-* pattern (or
+no --drop-* patterns are passed) and it does not match a --keep-* pattern, e.g.
+--keep-label 'org.opencontainers.image.*' removes all other labels and
+--drop-image-annotation 'com.docker.*' only removes those annotations.`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		oci := args[0]
 
+		labels := resetLabelsFlags.options()
+		imageAnnotations := resetImageAnnotationsFlags.options()
+		indexAnnotations := resetIndexAnnotationsFlags.options()
+		descriptorAnnotations := resetDescriptorAnnotationsFlags.options()
+
 		{
 			path, err := layout.FromPath(oci)
 			must("could not load oci directory", err)
@@ -44,43 +76,118 @@ var CommandResetLabelsAndAnnotations = cobra.Command{
 			index, err = pkg.MutateOCITree(
 				index,
 				func(index v1.ImageIndex) (v1.ImageIndex, error) {
-					return pkg.ReplaceImageIndexAnnotations(index, map[string]string{}), nil
+					manifest, err := index.IndexManifest()
+					if err != nil {
+						return nil, fmt.Errorf("could not load oci image index manifest: %w", err)
+					}
+
+					return pkg.ReplaceImageIndexAnnotations(index, indexAnnotations.apply(manifest.Annotations)), nil
 				}, func(image v1.Image) (v1.Image, error) {
 					configFile, err := image.ConfigFile()
 					if err != nil {
 						return nil, fmt.Errorf("could not parse config file: %w", err)
 					}
 
-					configFile.Config.Labels = map[string]string{}
+					configFile.Config.Labels = labels.apply(configFile.Config.Labels)
 
 					image, err = mutate.ConfigFile(image, configFile)
 					if err != nil {
 						return nil, fmt.Errorf("could not replace config file: %w", err)
 					}
 
-					return pkg.ReplaceImageAnnotations(image, map[string]string{}), nil
+					manifest, err := image.Manifest()
+					if err != nil {
+						return nil, fmt.Errorf("could not load oci image manifest: %w", err)
+					}
+
+					return pkg.ReplaceImageAnnotations(image, imageAnnotations.apply(manifest.Annotations)), nil
 				}, func(descriptor v1.Descriptor) (v1.Descriptor, error) {
-					descriptor.Annotations = map[string]string{}
+					descriptor.Annotations = descriptorAnnotations.apply(descriptor.Annotations)
 					return descriptor, nil
 				},
 			)
 			must("could not modify oci tree", err)
 
-			_, err = layout.Write(oci, index)
-			must("could not write image", err)
+			writeLayout(cmd.OutOrStdout(), oci, index)
 		}
+	},
+}
 
-		{
-			path, err := layout.FromPath(oci)
-			must("could not load oci directory", err)
+// annotationFilterFlags holds the unparsed --keep-* and --drop-* glob patterns
+// for one kind of labels or annotations.
+type annotationFilterFlags struct {
+	name string
+	keep []string
+	drop []string
+}
 
-			hashesToRemove, err := path.GarbageCollect()
-			must("could not garbage collect oci image", err)
+func (f *annotationFilterFlags) addFlags(flags *pflag.FlagSet, name string, description string) {
+	f.name = name
+	flags.StringArrayVar(&f.keep, "keep-"+name, nil, fmt.Sprintf("glob pattern of %s to keep, can be repeated", description))
+	flags.StringArrayVar(&f.drop, "drop-"+name, nil, fmt.Sprintf("glob pattern of %s to remove, all are removed if not set, can be repeated", description))
+}
+
+func (f *annotationFilterFlags) options() annotationFilter {
+	return annotationFilter{
+		keep: compileGlobs("invalid --keep-"+f.name, f.keep),
+		drop: compileGlobs("invalid --drop-"+f.name, f.drop),
+	}
+}
+
+// compileGlobs converts glob patterns to regular expressions, "*" matches any
+// sequence of characters and "?" matches a single character.
+func compileGlobs(msg string, patterns []string) []*regexp.Regexp {
+	globs := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		if pattern == "" {
+			fail("%s: empty pattern", msg)
+		}
 
-			for _, hash := range hashesToRemove {
-				err := path.RemoveBlob(hash)
-				must("could not remove blob", err)
+		var expr strings.Builder
+		expr.WriteString("^")
+		for _, r := range pattern {
+			switch r {
+			case '*':
+				expr.WriteString(".*")
+			case '?':
+				expr.WriteString(".")
+			default:
+				expr.WriteString(regexp.QuoteMeta(string(r)))
 			}
 		}
-	},
+		expr.WriteString("$")
+
+		globs = append(globs, regexp.MustCompile(expr.String()))
+	}
+	return globs
+}
+
+// annotationFilter decides which labels or annotations are removed: a key is
+// removed if it matches a drop pattern (or there are no drop patterns) and it
+// does not match a keep pattern.
+type annotationFilter struct {
+	keep []*regexp.Regexp
+	drop []*regexp.Regexp
+}
+
+func (f annotationFilter) apply(annotations map[string]string) map[string]string {
+	result := maps.Clone(annotations)
+	if result == nil {
+		result = map[string]string{}
+	}
+
+	maps.DeleteFunc(result, func(key string, _ string) bool {
+		return (len(f.drop) == 0 || matchesAny(f.drop, key)) && !matchesAny(f.keep, key)
+	})
+
+	return result
+}
+
+func matchesAny(patterns []*regexp.Regexp, key string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(key) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,128 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestCompileGlobs(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		matching []string
+		other    []string
+	}{
+		{
+			pattern:  "org.opencontainers.image.*",
+			matching: []string{"org.opencontainers.image.source", "org.opencontainers.image."},
+			other:    []string{"org.opencontainers.image", "orgXopencontainersXimageXsource", "x.org.opencontainers.image.source"},
+		},
+		{
+			pattern:  "com.docker.*.version",
+			matching: []string{"com.docker.official-images.version", "com.docker..version"},
+			other:    []string{"com.docker.version", "com.docker.a.version.x"},
+		},
+		{
+			pattern:  "v?",
+			matching: []string{"v1", "vv"},
+			other:    []string{"v", "v10"},
+		},
+		{
+			pattern:  "a+b[c](d)",
+			matching: []string{"a+b[c](d)"},
+			other:    []string{"aab[c](d)", "a+bc(d)"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			globs := compileGlobs("invalid pattern", []string{test.pattern})
+
+			for _, key := range test.matching {
+				if !matchesAny(globs, key) {
+					t.Errorf("expected %q to match %q", test.pattern, key)
+				}
+			}
+			for _, key := range test.other {
+				if matchesAny(globs, key) {
+					t.Errorf("expected %q not to match %q", test.pattern, key)
+				}
+			}
+		})
+	}
+}
+
+func TestAnnotationFilterApply(t *testing.T) {
+	annotations := map[string]string{
+		"org.opencontainers.image.source":  "source",
+		"org.opencontainers.image.version": "version",
+		"com.docker.official-images":       "docker",
+		"maintainer":                       "maintainer",
+	}
+
+	tests := []struct {
+		name     string
+		keep     []string
+		drop     []string
+		expected map[string]string
+	}{
+		{
+			name:     "remove all",
+			expected: map[string]string{},
+		},
+		{
+			name: "keep",
+			keep: []string{"org.opencontainers.image.*"},
+			expected: map[string]string{
+				"org.opencontainers.image.source":  "source",
+				"org.opencontainers.image.version": "version",
+			},
+		},
+		{
+			name: "drop",
+			drop: []string{"com.docker.*", "maintainer"},
+			expected: map[string]string{
+				"org.opencontainers.image.source":  "source",
+				"org.opencontainers.image.version": "version",
+			},
+		},
+		{
+			name: "keep wins over drop",
+			keep: []string{"*.version"},
+			drop: []string{"org.opencontainers.image.*"},
+			expected: map[string]string{
+				"org.opencontainers.image.version": "version",
+				"com.docker.official-images":       "docker",
+				"maintainer":                       "maintainer",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter := annotationFilter{
+				keep: compileGlobs("invalid keep pattern", test.keep),
+				drop: compileGlobs("invalid drop pattern", test.drop),
+			}
+
+			if result := filter.apply(annotations); !maps.Equal(result, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/spf13/cobra"
+
+	"github.com/cert-manager/image-tool/pkg"
+)
+
+var (
+	resetLayerTimestampsPlatforms []string
+	resetLayerTimestampsTimestamp string
+	resetLayerTimestampsComp      compressionFlags
+)
+
+func init() {
+	CommandResetLayerTimestamps.Flags().StringArrayVar(&resetLayerTimestampsPlatforms, "platform", nil, "only rewrite the layers of images matching this platform (e.g. linux/arm64), can be repeated")
+	CommandResetLayerTimestamps.Flags().StringVar(&resetLayerTimestampsTimestamp, "timestamp", "", "timestamp to clamp to, as unix seconds or RFC 3339 (e.g. 2025-01-01T00:00:00Z), defaults to SOURCE_DATE_EPOCH")
+	resetLayerTimestampsComp.addFlags(CommandResetLayerTimestamps.Flags())
+}
+
+var CommandResetLayerTimestamps = cobra.Command{
+	Use:   "reset-layer-timestamps oci-layout-path",
+	Short: "Clamps the file modification times in every layer of every image in an OCI index",
+	Long: `Clamps the file modification times in every layer of every image in an OCI
+index to the --timestamp value, or to SOURCE_DATE_EPOCH (or the unix epoch if
+it is not set).
+
+Modification times after the timestamp are set to the timestamp, access and
+change times are removed. The layers are rewritten in the PAX tar format and
+recompressed with --compression, the diff_ids, manifests and indices are
+updated accordingly. The history and the image config are kept. Layers that
+are not distributable (foreign layers) are kept as-is.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		oci := args[0]
+
+		platforms := parsePlatforms(resetLayerTimestampsPlatforms)
+		comp := resetLayerTimestampsComp.options(cmd.Flags())
+
+		timestamp := sourceDateEpoch()
+		if resetLayerTimestampsTimestamp != "" {
+			timestamp = parseTimestamp("invalid --timestamp", resetLayerTimestampsTimestamp)
+		}
+
+		{
+			path, err := layout.FromPath(oci)
+			must("could not load oci directory", err)
+
+			index, err := path.ImageIndex()
+			must("could not load oci image index", err)
+
+			err = checkPlatformsMatch(index, nil, platforms)
+			must("invalid --platform", err)
+
+			// Images in an index often share layers, so every layer is only
+			// rewritten once per media type
+			type layerKey struct {
+				digest    v1.Hash
+				mediaType types.MediaType
+			}
+			rewritten := map[layerKey]v1.Layer{}
+
+			index, err = pkg.MutateOCITreeWithDescriptors(
+				index, nil,
+				func(descriptors []*v1.Descriptor, img v1.Image) (v1.Image, error) {
+					platform, err := pkg.ImagePlatform(descriptors, img)
+					if err != nil {
+						return nil, err
+					}
+
+					if !pkg.MatchesPlatform(platform, platforms) {
+						return img, nil
+					}
+
+					imgMediaType, err := img.MediaType()
+					if err != nil {
+						return nil, fmt.Errorf("could not get image media type: %w", err)
+					}
+
+					layerType, err := comp.MediaType(imgMediaType)
+					if err != nil {
+						return nil, err
+					}
+
+					return pkg.RewriteLayers(img, func(_ int, layer v1.Layer) (v1.Layer, error) {
+						mediaType, err := layer.MediaType()
+						if err != nil {
+							return nil, fmt.Errorf("could not get layer media type: %w", err)
+						}
+
+						if !mediaType.IsDistributable() {
+							return nil, nil
+						}
+
+						digest, err := layer.Digest()
+						if err != nil {
+							return nil, fmt.Errorf("could not get layer digest: %w", err)
+						}
+
+						key := layerKey{digest: digest, mediaType: layerType}
+						if cached, ok := rewritten[key]; ok {
+							return cached, nil
+						}
+
+						result, err := clampLayerTimestamps(layer, timestamp, comp, layerType)
+						if err != nil {
+							return nil, fmt.Errorf("could not rewrite layer %s: %w", digest, err)
+						}
+
+						rewritten[key] = result
+						return result, nil
+					})
+				},
+				nil,
+			)
+			must("could not modify oci tree", err)
+
+			writeLayout(cmd.OutOrStdout(), oci, index)
+		}
+	},
+}
+
+func clampLayerTimestamps(layer v1.Layer, timestamp time.Time, comp layerCompression, layerType types.MediaType) (v1.Layer, error) {
+	spool := newSpoolFile("clamp-*.tar")
+	defer spool.Close()
+
+	bw := bufio.NewWriter(spool)
+	if err := pkg.ClampLayerTimestamps(bw, layer, timestamp); err != nil {
+		return nil, err
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, fmt.Errorf("could not write layer: %w", err)
+	}
+	if err := spool.Close(); err != nil {
+		return nil, fmt.Errorf("could not write layer: %w", err)
+	}
+
+	return newUntypedLayer(fileOpener(spool.Name())).ToLayer(comp, layerType)
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/spf13/cobra"
+
+	"github.com/cert-manager/image-tool/pkg"
+)
+
+var resetTimestampsTimestamp string
+
+func init() {
+	CommandResetTimestamps.Flags().StringVar(&resetTimestampsTimestamp, "timestamp", "", "timestamp to set, as unix seconds or RFC 3339 (e.g. 2025-01-01T00:00:00Z), defaults to SOURCE_DATE_EPOCH")
+}
+
+var CommandResetTimestamps = cobra.Command{
+	Use:   "reset-timestamps oci-layout-path",
+	Short: "Sets the created timestamps in the config and history of every image in an OCI index",
+	Long: `Sets the created timestamp in the config and of every history entry of every
+image in an OCI index to the --timestamp value, or to SOURCE_DATE_EPOCH (or the
+unix epoch if it is not set).
+
+Layer contents are not changed.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		oci := args[0]
+
+		timestamp := sourceDateEpoch()
+		if resetTimestampsTimestamp != "" {
+			timestamp = parseTimestamp("invalid --timestamp", resetTimestampsTimestamp)
+		}
+
+		{
+			path, err := layout.FromPath(oci)
+			must("could not load oci directory", err)
+
+			index, err := path.ImageIndex()
+			must("could not load oci image index", err)
+
+			index, err = pkg.MutateOCITree(
+				index, nil,
+				func(image v1.Image) (v1.Image, error) {
+					configFile, err := image.ConfigFile()
+					if err != nil {
+						return nil, fmt.Errorf("could not parse config file: %w", err)
+					}
+
+					configFile = configFile.DeepCopy()
+					configFile.Created = v1.Time{Time: timestamp}
+					for i := range configFile.History {
+						configFile.History[i].Created = v1.Time{Time: timestamp}
+					}
+
+					image, err = mutate.ConfigFile(image, configFile)
+					if err != nil {
+						return nil, fmt.Errorf("could not replace config file: %w", err)
+					}
+
+					return image, nil
+				},
+				nil,
+			)
+			must("could not modify oci tree", err)
+
+			writeLayout(cmd.OutOrStdout(), oci, index)
+		}
+	},
+}
+
+// parseTimestamp parses unix seconds or an RFC 3339 timestamp.
+func parseTimestamp(msg string, value string) time.Time {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC()
+	}
+
+	timestamp, err := time.Parse(time.RFC3339, value)
+	must(msg, err)
+
+	return timestamp.UTC()
+}
@@ -28,13 +28,39 @@ var CommandRoot = cobra.Command{
 }
 
 func Run() {
+	CommandRoot.AddCommand(&CommandAppendFiles)
 	CommandRoot.AddCommand(&CommandAppendLayers)
 	CommandRoot.AddCommand(&CommandConvertToDockerTar)
 	CommandRoot.AddCommand(&CommandConvertFromOCITar)
+	CommandRoot.AddCommand(&CommandCopyFrom)
 	CommandRoot.AddCommand(&CommandListDigests)
+	CommandRoot.AddCommand(&CommandMutateConfig)
+	CommandRoot.AddCommand(&CommandRebase)
+	CommandRoot.AddCommand(&CommandRemovePaths)
 	CommandRoot.AddCommand(&CommandResetLabelsAndAnnotations)
+	CommandRoot.AddCommand(&CommandResetLayerTimestamps)
+	CommandRoot.AddCommand(&CommandResetTimestamps)
+	CommandRoot.AddCommand(&CommandSetLabelsAndAnnotations)
+	CommandRoot.AddCommand(&CommandSquashLayers)
 	CommandRoot.AddCommand(&CommandTagDockerTar)
-	must("error running command", CommandRoot.Execute())
+	err := CommandRoot.Execute()
+	runCleanups()
+	must("error running command", err)
+}
+
+var cleanups []func()
+
+// addCleanup registers a function that is run before the process exits, also
+// when the command fails.
+func addCleanup(fn func()) {
+	cleanups = append(cleanups, fn)
+}
+
+func runCleanups() {
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+	cleanups = nil
 }
 
 func must(msg string, err error) {
@@ -45,5 +71,6 @@ func must(msg string, err error) {
 
 func fail(msg string, a ...any) {
 	fmt.Fprintf(os.Stderr, msg+"\n", a...)
+	runCleanups()
 	os.Exit(1)
 }
@@ -0,0 +1,206 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/cert-manager/image-tool/pkg"
+)
+
+var (
+	setLabelsFlags                annotationFlags
+	setImageAnnotationsFlags      annotationFlags
+	setIndexAnnotationsFlags      annotationFlags
+	setDescriptorAnnotationsFlags annotationFlags
+)
+
+func init() {
+	setLabelsFlags.addFlags(CommandSetLabelsAndAnnotations.Flags(), "label", "config label")
+	setImageAnnotationsFlags.addFlags(CommandSetLabelsAndAnnotations.Flags(), "image-annotation", "image manifest annotation")
+	setIndexAnnotationsFlags.addFlags(CommandSetLabelsAndAnnotations.Flags(), "index-annotation", "index annotation")
+	setDescriptorAnnotationsFlags.addFlags(CommandSetLabelsAndAnnotations.Flags(), "descriptor-annotation", "annotation on the descriptors in indices")
+}
+
+var CommandSetLabelsAndAnnotations = cobra.Command{
+	Use:   "set-labels-and-annotations oci-layout-path",
+	Short: "Adds, replaces or removes labels and annotations of OCI indices, images and descriptors in a OCI layout directory",
+	Long: `Adds, replaces or removes labels and annotations of OCI indices, images and
+descriptors in a OCI layout directory. Labels and annotations that are not
+mentioned are kept.
+
+Every flag takes "key=value" to add or replace a value, or "key-" to remove
+it. The --*-file flags read the same format from a file, one entry per line,
+ignoring empty lines and lines starting with "#". Files are applied before the
+values passed on the command line.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		oci := args[0]
+
+		labels := setLabelsFlags.options()
+		imageAnnotations := setImageAnnotationsFlags.options()
+		indexAnnotations := setIndexAnnotationsFlags.options()
+		descriptorAnnotations := setDescriptorAnnotationsFlags.options()
+
+		{
+			path, err := layout.FromPath(oci)
+			must("could not load oci directory", err)
+
+			index, err := path.ImageIndex()
+			must("could not load oci image index", err)
+
+			var (
+				mutIndexFn      pkg.IndexMutateFn
+				mutImageFn      pkg.ImageMutateFn
+				mutDescriptorFn pkg.DescriptorMutateFn
+			)
+
+			if !indexAnnotations.empty() {
+				mutIndexFn = func(index v1.ImageIndex) (v1.ImageIndex, error) {
+					return pkg.MergeImageIndexAnnotations(index, indexAnnotations.set, indexAnnotations.remove), nil
+				}
+			}
+
+			if !labels.empty() || !imageAnnotations.empty() {
+				mutImageFn = func(image v1.Image) (v1.Image, error) {
+					if !labels.empty() {
+						configFile, err := image.ConfigFile()
+						if err != nil {
+							return nil, fmt.Errorf("could not parse config file: %w", err)
+						}
+
+						configFile = configFile.DeepCopy()
+						configFile.Config.Labels = pkg.MergeAnnotations(configFile.Config.Labels, labels.set, labels.remove)
+
+						image, err = mutate.ConfigFile(image, configFile)
+						if err != nil {
+							return nil, fmt.Errorf("could not replace config file: %w", err)
+						}
+					}
+
+					if !imageAnnotations.empty() {
+						image = pkg.MergeImageAnnotations(image, imageAnnotations.set, imageAnnotations.remove)
+					}
+
+					return image, nil
+				}
+			}
+
+			if !descriptorAnnotations.empty() {
+				mutDescriptorFn = func(descriptor v1.Descriptor) (v1.Descriptor, error) {
+					descriptor.Annotations = pkg.MergeAnnotations(descriptor.Annotations, descriptorAnnotations.set, descriptorAnnotations.remove)
+					if len(descriptor.Annotations) == 0 {
+						descriptor.Annotations = nil
+					}
+					return descriptor, nil
+				}
+			}
+
+			index, err = pkg.MutateOCITree(index, mutIndexFn, mutImageFn, mutDescriptorFn)
+			must("could not modify oci tree", err)
+
+			writeLayout(cmd.OutOrStdout(), oci, index)
+		}
+	},
+}
+
+// annotationFlags holds the unparsed "key=value" and "key-" flags and files
+// for one kind of labels or annotations.
+type annotationFlags struct {
+	name   string
+	values []string
+	files  []string
+}
+
+func (f *annotationFlags) addFlags(flags *pflag.FlagSet, name string, description string) {
+	f.name = name
+	flags.StringArrayVar(&f.values, name, nil, fmt.Sprintf("key=value %s to add or replace, or key- to remove it, can be repeated", description))
+	flags.StringArrayVar(&f.files, name+"-file", nil, fmt.Sprintf("file with a key=value or key- %s per line, can be repeated", description))
+}
+
+func (f *annotationFlags) options() annotationChanges {
+	changes := annotationChanges{set: map[string]string{}}
+
+	for _, file := range f.files {
+		msg := fmt.Sprintf("invalid --%s-file %q", f.name, file)
+
+		data, err := os.ReadFile(file)
+		must(msg, err)
+
+		scanner := bufio.NewScanner(strings.NewReader(string(data)))
+		for line := 1; scanner.Scan(); line++ {
+			entry := strings.TrimSpace(scanner.Text())
+			if entry == "" || strings.HasPrefix(entry, "#") {
+				continue
+			}
+
+			must(msg, changes.add(fmt.Sprintf("line %d", line), entry))
+		}
+		must(msg, scanner.Err())
+	}
+
+	for _, value := range f.values {
+		must("invalid --"+f.name, changes.add("value", value))
+	}
+
+	return changes
+}
+
+// annotationChanges are applied to existing labels or annotations using
+// pkg.MergeAnnotations.
+type annotationChanges struct {
+	set    map[string]string
+	remove []string
+}
+
+func (c *annotationChanges) add(location string, entry string) error {
+	key, value, found := strings.Cut(entry, "=")
+	if !found {
+		key, found = strings.CutSuffix(entry, "-")
+		if !found || key == "" {
+			return fmt.Errorf("%s: %q must have the form key=value or key-", location, entry)
+		}
+
+		delete(c.set, key)
+		if !slices.Contains(c.remove, key) {
+			c.remove = append(c.remove, key)
+		}
+		return nil
+	}
+
+	if key == "" {
+		return fmt.Errorf("%s: %q has an empty key", location, entry)
+	}
+
+	c.remove = slices.DeleteFunc(c.remove, func(removed string) bool { return removed == key })
+	c.set[key] = value
+	return nil
+}
+
+func (c annotationChanges) empty() bool {
+	return len(c.set) == 0 && len(c.remove) == 0
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/cert-manager/image-tool/pkg"
+)
+
+func TestAnnotationChanges(t *testing.T) {
+	tests := []struct {
+		name          string
+		entries       []string
+		existing      map[string]string
+		expected      map[string]string
+		expectedError bool
+	}{
+		{
+			name:     "add and replace",
+			entries:  []string{"a=1", "b=2"},
+			existing: map[string]string{"a": "0", "c": "3"},
+			expected: map[string]string{"a": "1", "b": "2", "c": "3"},
+		},
+		{
+			name:     "remove",
+			entries:  []string{"a-"},
+			existing: map[string]string{"a": "0", "c": "3"},
+			expected: map[string]string{"c": "3"},
+		},
+		{
+			name:     "value may contain = and end with -",
+			entries:  []string{"a=b=c-"},
+			expected: map[string]string{"a": "b=c-"},
+		},
+		{
+			name:     "empty value",
+			entries:  []string{"a="},
+			expected: map[string]string{"a": ""},
+		},
+		{
+			name:     "later entry wins over remove",
+			entries:  []string{"a-", "a=1"},
+			existing: map[string]string{"a": "0"},
+			expected: map[string]string{"a": "1"},
+		},
+		{
+			name:     "later remove wins over entry",
+			entries:  []string{"a=1", "a-"},
+			existing: map[string]string{"a": "0"},
+			expected: map[string]string{},
+		},
+		{name: "missing value", entries: []string{"a"}, expectedError: true},
+		{name: "empty key", entries: []string{"=1"}, expectedError: true},
+		{name: "empty key removed", entries: []string{"-"}, expectedError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes := annotationChanges{set: map[string]string{}}
+
+			var err error
+			for _, entry := range test.entries {
+				if err = changes.add("value", entry); err != nil {
+					break
+				}
+			}
+			if test.expectedError {
+				if err == nil {
+					t.Fatalf("expected an error for %q", test.entries)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result := pkg.MergeAnnotations(test.existing, changes.set, changes.remove)
+			if !maps.Equal(result, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestAnnotationChangesAddLocation(t *testing.T) {
+	changes := annotationChanges{set: map[string]string{}}
+
+	err := changes.add("line 3", "invalid")
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3: ") {
+		t.Errorf("expected an error for line 3, got %v", err)
+	}
+	if !changes.empty() {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+}
@@ -0,0 +1,38 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// sourceDateEpoch returns the time set in the SOURCE_DATE_EPOCH environment
+// variable (see https://reproducible-builds.org/docs/source-date-epoch/), or
+// the unix epoch if the variable is not set.
+func sourceDateEpoch() time.Time {
+	value, ok := os.LookupEnv("SOURCE_DATE_EPOCH")
+	if !ok || value == "" {
+		return time.Unix(0, 0).UTC()
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	must("invalid SOURCE_DATE_EPOCH", err)
+
+	return time.Unix(seconds, 0).UTC()
+}
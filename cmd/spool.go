@@ -0,0 +1,51 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+var spoolDir string
+
+// newSpoolFile creates a temporary file that is removed when the command
+// exits. Spool files are used to keep large layers out of memory.
+func newSpoolFile(pattern string) *os.File {
+	if spoolDir == "" {
+		dir, err := os.MkdirTemp("", "image-tool-spool-")
+		must("could not create spool directory", err)
+
+		spoolDir = dir
+		addCleanup(func() {
+			_ = os.RemoveAll(dir)
+		})
+	}
+
+	file, err := os.CreateTemp(spoolDir, pattern)
+	must("could not create spool file", err)
+
+	return file
+}
+
+func fileOpener(path string) tarball.Opener {
+	return func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/spf13/cobra"
+
+	"github.com/cert-manager/image-tool/pkg"
+)
+
+var (
+	squashLayersPlatforms []string
+	squashLayersFrom      int
+	squashLayersTo        int
+	squashLayersComp      compressionFlags
+)
+
+func init() {
+	CommandSquashLayers.Flags().StringArrayVar(&squashLayersPlatforms, "platform", nil, "only squash images matching this platform (e.g. linux/arm64), can be repeated")
+	CommandSquashLayers.Flags().IntVar(&squashLayersFrom, "from", 0, "index of the first layer to squash, negative values count from the top layer (-1 is the top layer)")
+	CommandSquashLayers.Flags().IntVar(&squashLayersTo, "to", 0, "index after the last layer to squash, values <= 0 count from the top layer (0 includes the top layer)")
+	squashLayersComp.addFlags(CommandSquashLayers.Flags())
+}
+
+var CommandSquashLayers = cobra.Command{
+	Use:   "squash-layers oci-layout-path",
+	Short: "Squashes the layers of every image in an OCI index into a single layer",
+	Long: `Squashes the layers of every image in an OCI index into a single layer.
+
+By default all layers are squashed, --from and --to select a range of layers
+instead (e.g. --from 3 squashes all layers appended to a base image with 3
+layers). Whiteouts are applied to the squashed layers, whiteouts that remove
+files from the layers below the range are kept. A hardlink keeps the contents of
+a target that is removed or replaced by an upper layer, like on an overlay
+filesystem. The diff_ids and history of the image are rewritten to match, the
+squashed layer gets a single history entry.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		oci := args[0]
+
+		platforms := parsePlatforms(squashLayersPlatforms)
+		comp := squashLayersComp.options(cmd.Flags())
+
+		{
+			path, err := layout.FromPath(oci)
+			must("could not load oci directory", err)
+
+			index, err := path.ImageIndex()
+			must("could not load oci image index", err)
+
+			err = checkPlatformsMatch(index, nil, platforms)
+			must("invalid --platform", err)
+
+			index, err = pkg.MutateOCITreeWithDescriptors(
+				index, nil,
+				func(descriptors []*v1.Descriptor, img v1.Image) (v1.Image, error) {
+					platform, err := pkg.ImagePlatform(descriptors, img)
+					if err != nil {
+						return nil, err
+					}
+
+					if !pkg.MatchesPlatform(platform, platforms) {
+						return img, nil
+					}
+
+					return squashImageLayers(img, squashLayersFrom, squashLayersTo, comp)
+				},
+				nil,
+			)
+			must("could not modify oci tree", err)
+
+			writeLayout(cmd.OutOrStdout(), oci, index)
+		}
+	},
+}
+
+// layerRange resolves the --from and --to flags to a [from, to) range of
+// layer indexes for an image with count layers.
+func layerRange(from, to, count int) (int, int, error) {
+	if from < 0 {
+		from += count
+	}
+	if to <= 0 {
+		to += count
+	}
+
+	if from < 0 || to > count || from > to {
+		return 0, 0, fmt.Errorf("layer range [%d, %d) is out of bounds for image with %d layers", from, to, count)
+	}
+
+	return from, to, nil
+}
+
+func squashImageLayers(img v1.Image, fromFlag, toFlag int, comp layerCompression) (v1.Image, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("could not get image layers: %w", err)
+	}
+
+	from, to, err := layerRange(fromFlag, toFlag, len(layers))
+	if err != nil {
+		return nil, err
+	}
+
+	if to-from < 2 {
+		return img, nil
+	}
+
+	imgMediaType, err := img.MediaType()
+	if err != nil {
+		return nil, fmt.Errorf("could not get image media type: %w", err)
+	}
+
+	layerType, err := comp.MediaType(imgMediaType)
+	if err != nil {
+		return nil, err
+	}
+
+	spool := newSpoolFile("squash-*.tar")
+	defer spool.Close()
+
+	bw := bufio.NewWriter(spool)
+	if err := pkg.SquashLayers(bw, layers[from:to], from > 0); err != nil {
+		return nil, fmt.Errorf("could not squash layers: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, fmt.Errorf("could not write squashed layer: %w", err)
+	}
+	if err := spool.Close(); err != nil {
+		return nil, fmt.Errorf("could not write squashed layer: %w", err)
+	}
+
+	layer, err := newUntypedLayer(fileOpener(spool.Name())).ToLayer(comp, layerType)
+	if err != nil {
+		return nil, fmt.Errorf("could not load squashed layer: %w", err)
+	}
+
+	return pkg.ReplaceLayers(img, from, to, []mutate.Addendum{
+		{
+			Layer: layer,
+			History: v1.History{
+				Created:   v1.Time{Time: sourceDateEpoch()},
+				CreatedBy: "image-tool squash-layers",
+				Comment:   fmt.Sprintf("squashed layers %d to %d", from, to-1),
+			},
+		},
+	})
+}
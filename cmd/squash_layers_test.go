@@ -0,0 +1,61 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLayerRange(t *testing.T) {
+	tests := []struct {
+		from, to, count          int
+		expectedFrom, expectedTo int
+		expectedError            bool
+	}{
+		{from: 0, to: 0, count: 5, expectedFrom: 0, expectedTo: 5},
+		{from: 3, to: 0, count: 5, expectedFrom: 3, expectedTo: 5},
+		{from: -2, to: 0, count: 5, expectedFrom: 3, expectedTo: 5},
+		{from: 1, to: 3, count: 5, expectedFrom: 1, expectedTo: 3},
+		{from: 0, to: -1, count: 5, expectedFrom: 0, expectedTo: 4},
+		{from: 5, to: 0, count: 5, expectedFrom: 5, expectedTo: 5},
+		{from: 0, to: 0, count: 0, expectedFrom: 0, expectedTo: 0},
+		{from: 6, to: 0, count: 5, expectedError: true},
+		{from: -6, to: 0, count: 5, expectedError: true},
+		{from: 0, to: 6, count: 5, expectedError: true},
+		{from: 3, to: 2, count: 5, expectedError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("from %d to %d of %d", test.from, test.to, test.count), func(t *testing.T) {
+			from, to, err := layerRange(test.from, test.to, test.count)
+			if test.expectedError {
+				if err == nil {
+					t.Fatalf("expected an error, got [%d, %d)", from, to)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if from != test.expectedFrom || to != test.expectedTo {
+				t.Errorf("expected [%d, %d), got [%d, %d)", test.expectedFrom, test.expectedTo, from, to)
+			}
+		})
+	}
+}
@@ -30,6 +30,10 @@ var CommandTagDockerTar = cobra.Command{
 	Short: "Replaces the image name in the docker tarball (image name should include a tag)",
 	Args:  cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
+		if dryRun {
+			fail("--dry-run is not supported by tag-docker-tar")
+		}
+
 		path := args[0]
 		imageName := args[1]
 
@@ -0,0 +1,475 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/compression"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/spf13/pflag"
+
+	"github.com/cert-manager/image-tool/pkg"
+)
+
+type untypedLayer struct {
+	tarball  tarball.Opener
+	platform *v1.Platform
+
+	// source is the path the layer was created from, if any
+	source string
+
+	// history is recorded in the image config for every image the layer is
+	// appended to
+	history v1.History
+
+	// compressed caches the layers per media type, so each layer is only
+	// compressed once even if it is appended to many images
+	compressed map[types.MediaType]v1.Layer
+}
+
+func newUntypedLayer(tarball tarball.Opener) untypedLayer {
+	return untypedLayer{
+		tarball:    tarball,
+		compressed: map[types.MediaType]v1.Layer{},
+	}
+}
+
+// newUntypedLayerFromArg creates a layer from a "path" or "platform=path"
+// argument. An argument that exists on disk as-is is always treated as a path.
+func newUntypedLayerFromArg(arg string, opts directoryLayerOptions) untypedLayer {
+	if _, err := os.Stat(arg); err == nil {
+		return newUntypedLayerFromPath(arg, opts)
+	}
+
+	spec, path, found := strings.Cut(arg, "=")
+	if !found {
+		return newUntypedLayerFromPath(arg, opts)
+	}
+
+	platform, err := v1.ParsePlatform(spec)
+	must("invalid platform", err)
+
+	layer := newUntypedLayerFromPath(path, opts)
+	layer.platform = platform
+	return layer
+}
+
+// directoryLayerFlags holds the unparsed command line flags that control how
+// layers are created from directories.
+type directoryLayerFlags struct {
+	dest  string
+	chown string
+	chmod string
+	umask string
+	uname string
+	gname string
+
+	xattrs         []string
+	capabilities   []string
+	preserveXattrs bool
+}
+
+func (f *directoryLayerFlags) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&f.chown, "chown", "0:0", "uid[:gid] that owns the files in directory layers, gid defaults to uid")
+	flags.StringVar(&f.chmod, "chmod", "", "octal mode for regular files in directory layers (e.g. 0755), defaults to the mode on disk")
+	flags.StringVar(&f.umask, "umask", "0", "octal mask of mode bits removed from files and directories in directory layers (e.g. 022)")
+	flags.StringVar(&f.uname, "uname", "", "user name recorded for the files in directory layers")
+	flags.StringVar(&f.gname, "gname", "", "group name recorded for the files in directory layers")
+	flags.StringArrayVar(&f.xattrs, "xattr", nil, "path:name=value extended attribute set on a path in directory layers (e.g. /app:user.key=value, 0x prefix for hex values), can be repeated")
+	flags.StringArrayVar(&f.capabilities, "cap", nil, "path=caps+flags file capabilities set on a path in directory layers (e.g. /app=cap_net_bind_service+ep), can be repeated")
+}
+
+func (f *directoryLayerFlags) options() directoryLayerOptions {
+	opts := directoryLayerOptions{
+		dest:  f.dest,
+		uname: f.uname,
+		gname: f.gname,
+		umask: parseMode("invalid --umask", f.umask),
+
+		preserveXattrs: f.preserveXattrs,
+
+		modTime: sourceDateEpoch(),
+	}
+
+	uid, gid, hasGid := strings.Cut(f.chown, ":")
+	if !hasGid {
+		gid = uid
+	}
+
+	var err error
+	opts.uid, err = strconv.Atoi(uid)
+	must("invalid --chown uid", err)
+	opts.gid, err = strconv.Atoi(gid)
+	must("invalid --chown gid", err)
+
+	if f.chmod != "" {
+		opts.fileMode = parseMode("invalid --chmod", f.chmod)
+		opts.overrideFileMode = true
+	}
+
+	opts.xattrs = map[string]map[string]string{}
+	opts.xattrsUsed = map[string]bool{}
+	setXattr := func(target, name, value string) {
+		target = normalizeEntryName(target, false)
+		if opts.xattrs[target] == nil {
+			opts.xattrs[target] = map[string]string{}
+		}
+		opts.xattrs[target][name] = value
+	}
+
+	for _, flag := range f.xattrs {
+		target, name, value, err := parseXattrFlag(flag)
+		must("invalid --xattr", err)
+		setXattr(target, name, value)
+	}
+
+	for _, flag := range f.capabilities {
+		target, value, err := parseCapabilityFlag(flag)
+		must("invalid --cap", err)
+		setXattr(target, capabilityXattr, value)
+	}
+
+	return opts
+}
+
+func parseMode(msg string, mode string) int64 {
+	value, err := strconv.ParseUint(mode, 8, 32)
+	must(msg, err)
+
+	if value&^0o7777 != 0 {
+		fail("%s: mode %q has bits outside of 07777", msg, mode)
+	}
+
+	return int64(value)
+}
+
+// directoryLayerOptions controls how the tar entries of a layer created from
+// a directory are generated.
+type directoryLayerOptions struct {
+	// dest is the absolute path in the image under which the directory
+	// contents are placed, "/" or "" places them at the image root.
+	dest string
+
+	uid   int
+	gid   int
+	uname string
+	gname string
+
+	// fileMode replaces the permission bits of regular files if
+	// overrideFileMode is set, directories keep the mode from disk
+	fileMode         int64
+	overrideFileMode bool
+
+	// umask is removed from the mode of every file and directory
+	umask int64
+
+	// modTime is recorded as the modification time of every entry
+	modTime time.Time
+
+	// preserveXattrs copies the extended attributes of the source files,
+	// which depend on the host, so it is off by default
+	preserveXattrs bool
+
+	// xattrs maps image paths (as returned by normalizeEntryName) to the
+	// extended attributes that are set on them, xattrsUsed records which of
+	// these paths were found in a directory
+	xattrs     map[string]map[string]string
+	xattrsUsed map[string]bool
+}
+
+// xattrRecords returns the PAX records for the extended attributes of an
+// entry: the attributes of the source file, overridden by the configured
+// attributes for the image path.
+func (opts directoryLayerOptions) xattrRecords(entryName string, source map[string]string) map[string]string {
+	entryName = normalizeEntryName(entryName, false)
+
+	configured, ok := opts.xattrs[entryName]
+	if ok {
+		opts.xattrsUsed[entryName] = true
+	}
+
+	if len(source) == 0 && len(configured) == 0 {
+		return nil
+	}
+
+	records := map[string]string{}
+	for name, value := range source {
+		records[paxXattrPrefix+name] = value
+	}
+	for name, value := range configured {
+		records[paxXattrPrefix+name] = value
+	}
+	return records
+}
+
+// checkXattrsUsed fails if an extended attribute was configured for a path
+// that is not part of any directory layer.
+func (opts directoryLayerOptions) checkXattrsUsed() {
+	var unused []string
+	for target := range opts.xattrs {
+		if !opts.xattrsUsed[target] {
+			unused = append(unused, "/"+target)
+		}
+	}
+
+	if len(unused) > 0 {
+		slices.Sort(unused)
+		fail("extended attributes configured for paths that are not in any directory layer: %s", strings.Join(unused, ", "))
+	}
+}
+
+// normalizeHeader applies the ownership and mode options to a tar header.
+func (opts directoryLayerOptions) normalizeHeader(header *tar.Header) {
+	header.Uid = opts.uid
+	header.Gid = opts.gid
+	header.Uname = opts.uname
+	header.Gname = opts.gname
+
+	if opts.overrideFileMode && header.Typeflag == tar.TypeReg {
+		header.Mode = opts.fileMode
+	}
+
+	if header.Typeflag != tar.TypeSymlink {
+		header.Mode &^= opts.umask
+	}
+}
+
+// writeHeader writes a header in the deterministic layer format: the tar
+// format is always PAX, the access and change times are never recorded, the
+// modification time is set to modTime and entry names are normalized.
+func (opts directoryLayerOptions) writeHeader(tw *tar.Writer, header *tar.Header) error {
+	header.Name = normalizeEntryName(header.Name, header.Typeflag == tar.TypeDir)
+	header.ModTime = opts.modTime
+	header.AccessTime = time.Time{}
+	header.ChangeTime = time.Time{}
+	header.Format = tar.FormatPAX
+
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("could not write tar header: %w", err)
+	}
+	return nil
+}
+
+// normalizeEntryName returns the name as a slash separated path, relative to
+// the image root and without "./" prefix. Directory names end with a slash, the
+// image root itself is "./".
+func normalizeEntryName(name string, isDir bool) string {
+	name = strings.TrimPrefix(pathpkg.Clean("/"+filepath.ToSlash(name)), "/")
+	if name == "" {
+		name = "."
+	}
+
+	if isDir {
+		name += "/"
+	}
+
+	return name
+}
+
+// destPrefix returns the cleaned dest path without leading slash, or "" when
+// the contents are placed at the image root.
+func (opts directoryLayerOptions) destPrefix() string {
+	return strings.TrimPrefix(pathpkg.Clean("/"+opts.dest), "/")
+}
+
+func newUntypedLayerFromPath(path string, opts directoryLayerOptions) untypedLayer {
+	stat, err := os.Stat(path)
+	must("could not open directory or tarball", err)
+
+	var layer untypedLayer
+	if stat.IsDir() {
+		// The tarball is written to a spool file instead of memory, so large
+		// directories can be appended with bounded memory usage
+		spool := newSpoolFile("layer-*.tar")
+		defer spool.Close()
+
+		bw := bufio.NewWriter(spool)
+		lw := newLayerWriter(bw)
+
+		// The dest directory is written root-owned with mode 0755 like its
+		// parents, the contents of the source directory are placed in it
+		dest := opts.destPrefix()
+		if dest == "" {
+			dest = "."
+		}
+		must("could not write tarball", lw.writeParents(dest, opts))
+		must("could not write tarball", lw.writeTree(path, dest, opts))
+
+		must("could not write tarball", lw.close())
+		must("could not write tarball", bw.Flush())
+		must("could not write tarball", spool.Close())
+
+		layer = newUntypedLayer(fileOpener(spool.Name()))
+	} else {
+		layer = newUntypedLayer(fileOpener(path))
+	}
+
+	layer.source = path
+	return layer
+}
+
+// MatchesPlatform returns true if the layer should be appended to an image
+// with the given platform.
+func (ul untypedLayer) MatchesPlatform(platform *v1.Platform) bool {
+	if ul.platform == nil {
+		return true
+	}
+
+	return pkg.MatchesPlatform(platform, []v1.Platform{*ul.platform})
+}
+
+// ToLayer returns the layer compressed with the given compression and media
+// type. The compressed layer is written to a spool file the first time, later
+// calls reuse that file instead of compressing the tarball again. Tarballs that
+// are already compressed with the requested algorithm are used as-is.
+func (ul untypedLayer) ToLayer(comp layerCompression, mediaType types.MediaType) (v1.Layer, error) {
+	if layer, ok := ul.compressed[mediaType]; ok {
+		return layer, nil
+	}
+
+	layer, err := newSpooledLayer(ul.tarball, comp, mediaType)
+	if err != nil {
+		return nil, err
+	}
+
+	ul.compressed[mediaType] = layer
+	return layer, nil
+}
+
+// spooledLayer is a compressed layer stored in a spool file.
+type spooledLayer struct {
+	path      string
+	digest    v1.Hash
+	diffID    v1.Hash
+	size      int64
+	mediaType types.MediaType
+}
+
+func newSpooledLayer(opener tarball.Opener, comp layerCompression, mediaType types.MediaType) (v1.Layer, error) {
+	rc, err := opener()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	br := bufio.NewReader(rc)
+	inputCompression, err := peekCompression(br)
+	if err != nil {
+		return nil, fmt.Errorf("could not detect layer compression: %w", err)
+	}
+
+	spool := newSpoolFile("layer-*")
+	defer spool.Close()
+
+	digester := sha256.New()
+	diffIDDigester := sha256.New()
+	out := io.MultiWriter(spool, digester)
+
+	if inputCompression != compression.None && inputCompression == comp.algorithm {
+		// Keep the compressed stream as-is, only decompress to compute the diff id
+		tee := io.TeeReader(br, out)
+
+		uncompressed, err := newDecompressReader(tee, inputCompression)
+		if err != nil {
+			return nil, fmt.Errorf("could not decompress layer: %w", err)
+		}
+		defer uncompressed.Close()
+
+		if _, err := io.Copy(diffIDDigester, uncompressed); err != nil {
+			return nil, fmt.Errorf("could not decompress layer: %w", err)
+		}
+		if _, err := io.Copy(io.Discard, tee); err != nil {
+			return nil, fmt.Errorf("could not write compressed layer: %w", err)
+		}
+	} else {
+		uncompressed, err := newDecompressReader(br, inputCompression)
+		if err != nil {
+			return nil, fmt.Errorf("could not decompress layer: %w", err)
+		}
+		defer uncompressed.Close()
+
+		compressor, err := comp.NewWriter(out)
+		if err != nil {
+			return nil, fmt.Errorf("could not compress layer: %w", err)
+		}
+
+		if _, err := io.Copy(io.MultiWriter(diffIDDigester, compressor), uncompressed); err != nil {
+			return nil, fmt.Errorf("could not compress layer: %w", err)
+		}
+		if err := compressor.Close(); err != nil {
+			return nil, fmt.Errorf("could not compress layer: %w", err)
+		}
+	}
+
+	stat, err := spool.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("could not write compressed layer: %w", err)
+	}
+	if err := spool.Close(); err != nil {
+		return nil, fmt.Errorf("could not write compressed layer: %w", err)
+	}
+
+	return partial.CompressedToLayer(&spooledLayer{
+		path: spool.Name(),
+		digest: v1.Hash{
+			Algorithm: "sha256",
+			Hex:       hex.EncodeToString(digester.Sum(nil)),
+		},
+		diffID: v1.Hash{
+			Algorithm: "sha256",
+			Hex:       hex.EncodeToString(diffIDDigester.Sum(nil)),
+		},
+		size:      stat.Size(),
+		mediaType: mediaType,
+	})
+}
+
+func (l *spooledLayer) Digest() (v1.Hash, error) {
+	return l.digest, nil
+}
+
+func (l *spooledLayer) DiffID() (v1.Hash, error) {
+	return l.diffID, nil
+}
+
+func (l *spooledLayer) Compressed() (io.ReadCloser, error) {
+	return os.Open(l.path)
+}
+
+func (l *spooledLayer) Size() (int64, error) {
+	return l.size, nil
+}
+
+func (l *spooledLayer) MediaType() (types.MediaType, error) {
+	return l.mediaType, nil
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+
+	"github.com/cert-manager/image-tool/pkg"
+)
+
+var dryRun bool
+
+func init() {
+	CommandRoot.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "report the changes to the OCI layout directory instead of writing them")
+}
+
+// writeLayout writes the mutated index to the OCI layout directory and
+// removes the blobs that are no longer referenced. With --dry-run, the
+// changes are only reported.
+func writeLayout(w io.Writer, oci string, index v1.ImageIndex) {
+	if dryRun {
+		before := loadIndex(oci)
+
+		changes, err := pkg.DiffOCITree(before, index)
+		must("could not compare oci tree", err)
+
+		existing, err := listBlobs(oci)
+		must("could not list blobs", err)
+
+		reportDryRun(w, before, index, changes, existing, nil)
+		return
+	}
+
+	// The referenced blobs are collected before anything is written, so an
+	// index that can't be garbage collected leaves the layout unchanged
+	referenced, err := pkg.ReferencedBlobs(index)
+	must("could not garbage collect oci image", err)
+
+	_, err = layout.Write(oci, index)
+	must("could not write image", err)
+
+	err = garbageCollect(oci, referenced)
+	must("could not garbage collect oci image", err)
+}
+
+// garbageCollect removes the blobs of the OCI layout directory that are not
+// referenced, see pkg.ReferencedBlobs. Unlike layout.Path.GarbageCollect, it
+// follows a symlinked blobs directory.
+func garbageCollect(oci string, referenced map[v1.Hash]int64) error {
+	blobs, err := listBlobs(oci)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range sortedHashes(blobs) {
+		if _, ok := referenced[hash]; ok {
+			continue
+		}
+		if err := layout.Path(oci).RemoveBlob(hash); err != nil {
+			return fmt.Errorf("could not remove blob: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// listBlobs returns the digests and sizes of the blobs in the OCI layout
+// directory. The blobs directory may be a symlink.
+func listBlobs(oci string) (map[v1.Hash]int64, error) {
+	blobs := map[v1.Hash]int64{}
+
+	// The trailing separator makes WalkDir follow a symlinked blobs directory
+	blobsDir := filepath.Join(oci, "blobs") + string(filepath.Separator)
+	err := filepath.WalkDir(blobsDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(blobsDir, path)
+		if err != nil {
+			return err
+		}
+		hash, err := v1.NewHash(strings.Replace(filepath.ToSlash(rel), "/", ":", 1))
+		if err != nil {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		blobs[hash] = info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list blobs: %w", err)
+	}
+
+	return blobs, nil
+}
+
+// reportDryRun prints the changes of the descriptors when the index of the OCI
+// layout directory (before) is replaced by another index (after), and the
+// blobs that would be written and garbage collected. Before is nil if there is
+// no index yet. Existing are the blobs in the layout directory, incoming are
+// blobs that are added to it before garbage collection (e.g. extracted from a
+// tarball).
+func reportDryRun(w io.Writer, before, after v1.ImageIndex, changes []pkg.DescriptorChange, existing, incoming map[v1.Hash]int64) {
+	if before != nil {
+		beforeDigest, err := before.Digest()
+		must("could not get index digest", err)
+		afterDigest, err := after.Digest()
+		must("could not get index digest", err)
+
+		fmt.Fprintf(w, "index.json: %s\n", describeChange(
+			&v1.Descriptor{Digest: beforeDigest, Size: mustSize(before.Size())},
+			&v1.Descriptor{Digest: afterDigest, Size: mustSize(after.Size())},
+		))
+	}
+
+	for _, change := range changes {
+		descriptor := change.After
+		if descriptor == nil {
+			descriptor = change.Before
+		}
+
+		name := change.Path
+		if descriptor.Platform != nil {
+			name += " (" + descriptor.Platform.String() + ")"
+		}
+
+		fmt.Fprintf(w, "%s: %s\n", name, describeChange(change.Before, change.After))
+	}
+
+	referenced, err := pkg.ReferencedBlobs(after)
+	must("could not list referenced blobs", err)
+
+	var writeCount, writeSize int64
+	for _, hash := range sortedHashes(referenced) {
+		if _, ok := existing[hash]; !ok {
+			fmt.Fprintf(w, "would write blob %s (%d bytes)\n", hash, referenced[hash])
+			writeCount++
+			writeSize += referenced[hash]
+		}
+	}
+
+	unreferenced := map[v1.Hash]int64{}
+	for _, blobs := range []map[v1.Hash]int64{existing, incoming} {
+		for hash, size := range blobs {
+			if _, ok := referenced[hash]; !ok {
+				unreferenced[hash] = size
+			}
+		}
+	}
+
+	var removeCount, removeSize int64
+	for _, hash := range sortedHashes(unreferenced) {
+		fmt.Fprintf(w, "would garbage collect blob %s (%d bytes)\n", hash, unreferenced[hash])
+		removeCount++
+		removeSize += unreferenced[hash]
+	}
+
+	fmt.Fprintf(w, "dry run: would write %d blobs (%d bytes) and garbage collect %d blobs (%d bytes), nothing was written\n", writeCount, writeSize, removeCount, removeSize)
+}
+
+func describeChange(before, after *v1.Descriptor) string {
+	switch {
+	case before == nil:
+		return fmt.Sprintf("added %s (%d bytes)", after.Digest, after.Size)
+	case after == nil:
+		return fmt.Sprintf("removed %s (%d bytes)", before.Digest, before.Size)
+	case before.Digest == after.Digest:
+		return fmt.Sprintf("unchanged %s (%d bytes)", before.Digest, before.Size)
+	default:
+		return fmt.Sprintf("%s (%d bytes) -> %s (%d bytes, %+d)", before.Digest, before.Size, after.Digest, after.Size, after.Size-before.Size)
+	}
+}
+
+func mustSize(size int64, err error) int64 {
+	must("could not get index size", err)
+	return size
+}
+
+func sortedHashes(blobs map[v1.Hash]int64) []v1.Hash {
+	hashes := make([]v1.Hash, 0, len(blobs))
+	for hash := range blobs {
+		hashes = append(hashes, hash)
+	}
+	slices.SortFunc(hashes, func(a, b v1.Hash) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	return hashes
+}
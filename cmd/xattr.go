@@ -0,0 +1,170 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	paxXattrPrefix = "SCHILY.xattr."
+
+	capabilityXattr = "security.capability"
+
+	// vfs_cap_data revision 2, see linux/capability.h
+	vfsCapRevision2      = 0x02000000
+	vfsCapFlagsEffective = 0x000001
+)
+
+// capabilities lists the linux capability names by their bit number.
+var capabilities = []string{
+	"cap_chown",
+	"cap_dac_override",
+	"cap_dac_read_search",
+	"cap_fowner",
+	"cap_fsetid",
+	"cap_kill",
+	"cap_setgid",
+	"cap_setuid",
+	"cap_setpcap",
+	"cap_linux_immutable",
+	"cap_net_bind_service",
+	"cap_net_broadcast",
+	"cap_net_admin",
+	"cap_net_raw",
+	"cap_ipc_lock",
+	"cap_ipc_owner",
+	"cap_sys_module",
+	"cap_sys_rawio",
+	"cap_sys_chroot",
+	"cap_sys_ptrace",
+	"cap_sys_pacct",
+	"cap_sys_admin",
+	"cap_sys_boot",
+	"cap_sys_nice",
+	"cap_sys_resource",
+	"cap_sys_time",
+	"cap_sys_tty_config",
+	"cap_mknod",
+	"cap_lease",
+	"cap_audit_write",
+	"cap_audit_control",
+	"cap_setfcap",
+	"cap_mac_override",
+	"cap_mac_admin",
+	"cap_syslog",
+	"cap_wake_alarm",
+	"cap_block_suspend",
+	"cap_audit_read",
+	"cap_perfmon",
+	"cap_bpf",
+	"cap_checkpoint_restore",
+}
+
+// ignoredXattrs are not preserved from the source files, because they
+// describe the host rather than the file.
+var ignoredXattrs = []string{
+	"security.selinux",
+}
+
+// parseXattrFlag parses a "path:name=value" xattr flag. Values starting with
+// "0x" are hex encoded.
+func parseXattrFlag(flag string) (string, string, string, error) {
+	target, value, found := strings.Cut(flag, "=")
+	if !found {
+		return "", "", "", fmt.Errorf("%q must have the form path:name=value", flag)
+	}
+
+	idx := strings.LastIndex(target, ":")
+	if idx < 0 {
+		return "", "", "", fmt.Errorf("%q must have the form path:name=value", flag)
+	}
+	target, name := target[:idx], target[idx+1:]
+
+	if name == "" || target == "" {
+		return "", "", "", fmt.Errorf("%q must have the form path:name=value", flag)
+	}
+
+	if hexValue, ok := strings.CutPrefix(value, "0x"); ok {
+		decoded, err := hex.DecodeString(hexValue)
+		if err != nil {
+			return "", "", "", fmt.Errorf("invalid hex value in %q: %w", flag, err)
+		}
+		value = string(decoded)
+	}
+
+	return target, name, value, nil
+}
+
+// parseCapabilityFlag parses a "path=caps+flags" capability flag, where caps
+// is a comma separated list of capability names and flags a combination of
+// e (effective), p (permitted) and i (inheritable), e.g.
+// "/usr/local/bin/app=cap_net_bind_service+ep". It returns the path and the
+// security.capability xattr value.
+func parseCapabilityFlag(flag string) (string, string, error) {
+	target, text, found := strings.Cut(flag, "=")
+	if !found || target == "" {
+		return "", "", fmt.Errorf("%q must have the form path=caps+flags", flag)
+	}
+
+	names, flags, found := strings.Cut(text, "+")
+	if !found {
+		return "", "", fmt.Errorf("%q must have the form path=caps+flags", flag)
+	}
+
+	var mask uint64
+	for name := range strings.SplitSeq(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !strings.HasPrefix(name, "cap_") {
+			name = "cap_" + name
+		}
+
+		bit := slices.Index(capabilities, name)
+		if bit < 0 {
+			return "", "", fmt.Errorf("unknown capability %q in %q", name, flag)
+		}
+		mask |= 1 << bit
+	}
+
+	var permitted, inheritable uint64
+	magic := uint32(vfsCapRevision2)
+	for _, f := range flags {
+		switch f {
+		case 'e':
+			magic |= vfsCapFlagsEffective
+		case 'p':
+			permitted = mask
+		case 'i':
+			inheritable = mask
+		default:
+			return "", "", fmt.Errorf("unknown capability flag %q in %q, must be e, p or i", f, flag)
+		}
+	}
+
+	value := make([]byte, 0, 20)
+	value = binary.LittleEndian.AppendUint32(value, magic)
+	value = binary.LittleEndian.AppendUint32(value, uint32(permitted))
+	value = binary.LittleEndian.AppendUint32(value, uint32(inheritable))
+	value = binary.LittleEndian.AppendUint32(value, uint32(permitted>>32))
+	value = binary.LittleEndian.AppendUint32(value, uint32(inheritable>>32))
+
+	return target, string(value), nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"syscall"
+)
+
+// readXattrs returns the extended attributes of the file. Symlinks are
+// followed, so callers must not pass symlinks. Attributes in ignoredXattrs are
+// skipped.
+func readXattrs(path string) (map[string]string, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if errors.Is(err, syscall.ENOTSUP) {
+		return nil, nil
+	}
+	if err != nil || size == 0 {
+		return nil, err
+	}
+
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	xattrs := map[string]string{}
+	for name := range bytes.SplitSeq(buf[:size], []byte{0}) {
+		if len(name) == 0 || slices.Contains(ignoredXattrs, string(name)) {
+			continue
+		}
+
+		valueSize, err := syscall.Getxattr(path, string(name), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		value := make([]byte, valueSize)
+		valueSize, err = syscall.Getxattr(path, string(name), value)
+		if err != nil {
+			return nil, err
+		}
+
+		xattrs[string(name)] = string(value[:valueSize])
+	}
+
+	return xattrs, nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseCapabilityFlag(t *testing.T) {
+	tests := []struct {
+		flag           string
+		expectedTarget string
+		// expectedValue is the hex encoded vfs_cap_data, as shown by
+		// getfattr -e hex -n security.capability
+		expectedValue string
+		expectedError bool
+	}{
+		{
+			flag:           "/app=cap_net_bind_service+ep",
+			expectedTarget: "/app",
+			expectedValue:  "0100000200040000000000000000000000000000",
+		},
+		{
+			flag:           "/app=NET_BIND_SERVICE+e",
+			expectedTarget: "/app",
+			expectedValue:  "0100000200000000000000000000000000000000",
+		},
+		{
+			flag:           "/app=cap_net_admin,cap_net_raw+p",
+			expectedTarget: "/app",
+			expectedValue:  "0000000200300000000000000000000000000000",
+		},
+		{
+			flag:           "/app=cap_chown+eip",
+			expectedTarget: "/app",
+			expectedValue:  "0100000201000000010000000000000000000000",
+		},
+		{
+			// Bits above 31 are stored in the second half of the masks
+			flag:           "/app=cap_bpf,cap_chown+pi",
+			expectedTarget: "/app",
+			expectedValue:  "0000000201000000010000008000000080000000",
+		},
+		{flag: "/app", expectedError: true},
+		{flag: "=cap_chown+ep", expectedError: true},
+		{flag: "/app=cap_chown", expectedError: true},
+		{flag: "/app=cap_unknown+ep", expectedError: true},
+		{flag: "/app=cap_chown+x", expectedError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.flag, func(t *testing.T) {
+			target, value, err := parseCapabilityFlag(test.flag)
+			if test.expectedError {
+				if err == nil {
+					t.Fatalf("expected an error, got target %q and value %x", target, value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if target != test.expectedTarget {
+				t.Errorf("expected target %q, got %q", test.expectedTarget, target)
+			}
+			if hexValue := hex.EncodeToString([]byte(value)); hexValue != test.expectedValue {
+				t.Errorf("expected value %s, got %s", test.expectedValue, hexValue)
+			}
+		})
+	}
+}
+
+func TestParseXattrFlag(t *testing.T) {
+	tests := []struct {
+		flag           string
+		expectedTarget string
+		expectedName   string
+		expectedValue  string
+		expectedError  bool
+	}{
+		{
+			flag:           "/app:user.key=value",
+			expectedTarget: "/app",
+			expectedName:   "user.key",
+			expectedValue:  "value",
+		},
+		{
+			flag:           "/a:b:user.key=a=b",
+			expectedTarget: "/a:b",
+			expectedName:   "user.key",
+			expectedValue:  "a=b",
+		},
+		{
+			flag:           "/app:user.key=0x0102",
+			expectedTarget: "/app",
+			expectedName:   "user.key",
+			expectedValue:  "\x01\x02",
+		},
+		{flag: "/app:user.key", expectedError: true},
+		{flag: "/app=value", expectedError: true},
+		{flag: ":user.key=value", expectedError: true},
+		{flag: "/app:user.key=0xzz", expectedError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.flag, func(t *testing.T) {
+			target, name, value, err := parseXattrFlag(test.flag)
+			if test.expectedError {
+				if err == nil {
+					t.Fatalf("expected an error, got target %q, name %q and value %q", target, name, value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if target != test.expectedTarget || name != test.expectedName || value != test.expectedValue {
+				t.Errorf("expected %q, %q and %q, got %q, %q and %q", test.expectedTarget, test.expectedName, test.expectedValue, target, name, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkg
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// ClampLayerTimestamps writes the layer to w as an uncompressed tarball, where
+// modification times after timestamp are set to timestamp and access and
+// change times are removed. All entries are written in the PAX format, so
+// extended attributes are kept.
+func ClampLayerTimestamps(w io.Writer, layer v1.Layer, timestamp time.Time) error {
+	tw := tar.NewWriter(w)
+
+	err := walkLayer(layer, func(_ int, header *tar.Header, contents io.Reader) error {
+		if header.Typeflag != tar.TypeXGlobalHeader {
+			if header.ModTime.After(timestamp) {
+				header.ModTime = timestamp
+			}
+			header.AccessTime = time.Time{}
+			header.ChangeTime = time.Time{}
+			header.Format = tar.FormatPAX
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("could not write tar header: %w", err)
+		}
+		if _, err := io.Copy(tw, contents); err != nil {
+			return fmt.Errorf("could not write tar contents: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkg
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestClampLayerTimestamps(t *testing.T) {
+	timestamp := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := timestamp.Add(-time.Hour)
+	after := timestamp.Add(time.Hour)
+
+	layer := newTestLayer(t,
+		testEntry{name: "old", typeflag: tar.TypeReg, contents: "old", modTime: before},
+		testEntry{name: "new", typeflag: tar.TypeReg, contents: "new", modTime: after},
+		testEntry{name: "exact", typeflag: tar.TypeDir, modTime: timestamp},
+		testEntry{name: "link", typeflag: tar.TypeLink, linkname: "new", modTime: after},
+	)
+
+	var buf bytes.Buffer
+	if err := ClampLayerTimestamps(&buf, layer, timestamp); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]time.Time{
+		"old":   before,
+		"new":   timestamp,
+		"exact": timestamp,
+		"link":  timestamp,
+	}
+
+	tr := tar.NewReader(&buf)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !header.ModTime.Equal(expected[header.Name]) {
+			t.Errorf("expected modification time %s for %q, got %s", expected[header.Name], header.Name, header.ModTime)
+		}
+		if !header.AccessTime.IsZero() || !header.ChangeTime.IsZero() {
+			t.Errorf("expected no access and change times for %q", header.Name)
+		}
+		delete(expected, header.Name)
+
+		if header.Typeflag == tar.TypeReg {
+			contents, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(contents) != header.Name {
+				t.Errorf("expected contents %q for %q, got %q", header.Name, header.Name, contents)
+			}
+		}
+	}
+
+	if len(expected) != 0 {
+		t.Errorf("expected entries %v to be written", expected)
+	}
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkg
+
+import (
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// DescriptorChange is a descriptor of an OCI tree before and after a mutation.
+type DescriptorChange struct {
+	// Path is the position of the descriptor in the tree, e.g.
+	// "manifests[0].manifests[1]"
+	Path string
+
+	// Before is nil if the descriptor was added, After is nil if it was
+	// removed
+	Before *v1.Descriptor
+	After  *v1.Descriptor
+}
+
+// DiffOCITree returns the image and index descriptors of the tree before a
+// mutation paired with the descriptors of the tree after it, which must be the
+// result of MutateOCITree on before. MutateOCITree keeps the order of the
+// image and index descriptors, so they are paired by position. Before or after
+// may be nil, in which case all descriptors are added or removed.
+func DiffOCITree(before, after v1.ImageIndex) ([]DescriptorChange, error) {
+	return diffOCITree(before, after, "")
+}
+
+func diffOCITree(before, after v1.ImageIndex, path string) ([]DescriptorChange, error) {
+	var beforeDescriptors []v1.Descriptor
+	if before != nil {
+		var err error
+		beforeDescriptors, err = treeDescriptors(before)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var afterDescriptors []v1.Descriptor
+	if after != nil {
+		var err error
+		afterDescriptors, err = treeDescriptors(after)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var changes []DescriptorChange
+	for i := range max(len(beforeDescriptors), len(afterDescriptors)) {
+		change := DescriptorChange{Path: fmt.Sprintf("%smanifests[%d]", path, i)}
+
+		var beforeChild, afterChild v1.ImageIndex
+		if i < len(beforeDescriptors) {
+			change.Before = &beforeDescriptors[i]
+			if change.Before.MediaType.IsIndex() {
+				var err error
+				beforeChild, err = before.ImageIndex(change.Before.Digest)
+				if err != nil {
+					return nil, fmt.Errorf("could not load oci image index from digest: %w", err)
+				}
+			}
+		}
+		if i < len(afterDescriptors) {
+			change.After = &afterDescriptors[i]
+			if change.After.MediaType.IsIndex() {
+				var err error
+				afterChild, err = after.ImageIndex(change.After.Digest)
+				if err != nil {
+					return nil, fmt.Errorf("could not load oci image index from digest: %w", err)
+				}
+			}
+		}
+
+		changes = append(changes, change)
+
+		if beforeChild != nil || afterChild != nil {
+			childChanges, err := diffOCITree(beforeChild, afterChild, change.Path+".")
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, childChanges...)
+		}
+	}
+
+	return changes, nil
+}
+
+// treeDescriptors returns the image and index descriptors of the index, the
+// other descriptors are not part of the OCI tree.
+func treeDescriptors(index v1.ImageIndex) ([]v1.Descriptor, error) {
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("could not load oci image manifest: %w", err)
+	}
+
+	var descriptors []v1.Descriptor
+	for _, descriptor := range manifest.Manifests {
+		if descriptor.MediaType.IsImage() || descriptor.MediaType.IsIndex() {
+			descriptors = append(descriptors, descriptor)
+		}
+	}
+	return descriptors, nil
+}
+
+// ReferencedBlobs returns the digests and sizes of the blobs that are
+// referenced by the OCI tree: the manifests, configs and layers. These are the
+// blobs that are kept when garbage collecting an OCI layout.
+func ReferencedBlobs(index v1.ImageIndex) (map[v1.Hash]int64, error) {
+	blobs := map[v1.Hash]int64{}
+
+	err := SearchOCITree(
+		index,
+		func(descriptors []*v1.Descriptor, index v1.ImageIndex) error {
+			if len(descriptors) > 0 {
+				descriptor := descriptors[len(descriptors)-1]
+				blobs[descriptor.Digest] = descriptor.Size
+			}
+
+			// The blobs of other descriptors would be removed, so they are
+			// refused like layout.Path.GarbageCollect does
+			manifest, err := index.IndexManifest()
+			if err != nil {
+				return fmt.Errorf("could not load oci image manifest: %w", err)
+			}
+			for _, descriptor := range manifest.Manifests {
+				if !descriptor.MediaType.IsImage() && !descriptor.MediaType.IsIndex() {
+					return fmt.Errorf("unknown media type: %s", descriptor.MediaType)
+				}
+			}
+			return nil
+		},
+		func(descriptors []*v1.Descriptor, img v1.Image) error {
+			descriptor := descriptors[len(descriptors)-1]
+			blobs[descriptor.Digest] = descriptor.Size
+
+			manifest, err := img.Manifest()
+			if err != nil {
+				return fmt.Errorf("could not get image manifest: %w", err)
+			}
+
+			blobs[manifest.Config.Digest] = manifest.Config.Size
+			for _, layer := range manifest.Layers {
+				blobs[layer.Digest] = layer.Size
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return blobs, nil
+}
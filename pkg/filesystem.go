@@ -0,0 +1,126 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkg
+
+import (
+	"archive/tar"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// FileSystem is the merged view of the entries of a stack of layers, it only
+// tracks the tar headers and not the contents.
+type FileSystem struct {
+	entries map[string]*tar.Header
+}
+
+// Conflict is an entry of a layer that overwrites an existing non-directory or
+// replaces an existing directory with a non-directory.
+type Conflict struct {
+	// Path is the entry name, as returned by CleanEntryName
+	Path string
+
+	Old *tar.Header
+	New *tar.Header
+}
+
+// NewFileSystem returns the merged view of the layers (lowest layer first).
+func NewFileSystem(layers []v1.Layer) (*FileSystem, error) {
+	fs := &FileSystem{entries: map[string]*tar.Header{}}
+	for _, layer := range layers {
+		if _, err := fs.Apply(layer); err != nil {
+			return nil, err
+		}
+	}
+	return fs, nil
+}
+
+// Apply adds the layer on top of the file system and returns the entries of
+// the layer that conflict with the existing entries. Paths removed by a
+// whiteout in the same layer don't conflict.
+func (fs *FileSystem) Apply(layer v1.Layer) ([]Conflict, error) {
+	var whiteouts []string
+	var opaques []string
+	var headers []*tar.Header
+
+	err := walkLayer(layer, func(_ int, header *tar.Header, _ io.Reader) error {
+		name := CleanEntryName(header.Name)
+		dir, base := path.Split(name)
+		dir = CleanEntryName(dir)
+
+		switch {
+		case base == WhiteoutOpaque:
+			opaques = append(opaques, dir)
+		case strings.HasPrefix(base, WhiteoutPrefix):
+			whiteouts = append(whiteouts, path.Join(dir, strings.TrimPrefix(base, WhiteoutPrefix)))
+		default:
+			headers = append(headers, header)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Whiteouts only apply to the lower layers, so they are applied before
+	// the entries of the layer
+	for _, dir := range opaques {
+		fs.removeChildren(dir)
+	}
+	for _, name := range whiteouts {
+		delete(fs.entries, name)
+		fs.removeChildren(name)
+	}
+
+	var conflicts []Conflict
+	for _, header := range headers {
+		name := CleanEntryName(header.Name)
+
+		old, ok := fs.entries[name]
+		if ok && (old.Typeflag != tar.TypeDir || header.Typeflag != tar.TypeDir) {
+			conflicts = append(conflicts, Conflict{Path: name, Old: old, New: header})
+		}
+
+		if ok && old.Typeflag == tar.TypeDir && header.Typeflag != tar.TypeDir {
+			fs.removeChildren(name)
+		}
+
+		fs.entries[name] = header
+	}
+
+	slices.SortFunc(conflicts, func(a, b Conflict) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return conflicts, nil
+}
+
+func (fs *FileSystem) removeChildren(dir string) {
+	prefix := dir + "/"
+	for name := range fs.entries {
+		if dir == "." || strings.HasPrefix(name, prefix) {
+			if name != "." {
+				delete(fs.entries, name)
+			}
+		}
+	}
+}
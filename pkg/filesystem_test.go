@@ -0,0 +1,136 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkg
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestFileSystemApply(t *testing.T) {
+	tests := []struct {
+		name              string
+		lower             [][]testEntry
+		upper             []testEntry
+		expectedConflicts []string
+		expectedEntries   []string
+	}{
+		{
+			name:            "new file",
+			lower:           [][]testEntry{{testDir("etc")}},
+			upper:           []testEntry{testFile("etc/passwd", "")},
+			expectedEntries: []string{"etc", "etc/passwd"},
+		},
+		{
+			name:              "file overwrites file",
+			lower:             [][]testEntry{{testFile("a", "old")}},
+			upper:             []testEntry{testFile("a", "new")},
+			expectedConflicts: []string{"a"},
+			expectedEntries:   []string{"a"},
+		},
+		{
+			name:            "directory over directory",
+			lower:           [][]testEntry{{testDir("etc"), testFile("etc/passwd", "")}},
+			upper:           []testEntry{testDir("etc")},
+			expectedEntries: []string{"etc", "etc/passwd"},
+		},
+		{
+			name:              "file replaces directory and its contents",
+			lower:             [][]testEntry{{testDir("etc"), testFile("etc/passwd", "")}},
+			upper:             []testEntry{testFile("etc", "")},
+			expectedConflicts: []string{"etc"},
+			expectedEntries:   []string{"etc"},
+		},
+		{
+			name:              "directory replaces file",
+			lower:             [][]testEntry{{testFile("a", "")}},
+			upper:             []testEntry{testDir("a")},
+			expectedConflicts: []string{"a"},
+			expectedEntries:   []string{"a"},
+		},
+		{
+			name:            "whiteout before the recreated file",
+			lower:           [][]testEntry{{testFile("a", "old")}},
+			upper:           []testEntry{testWhiteout(".wh.a"), testFile("a", "new")},
+			expectedEntries: []string{"a"},
+		},
+		{
+			// Whiteouts only apply to lower layers, independent of their
+			// position in the layer
+			name:            "whiteout after the recreated file",
+			lower:           [][]testEntry{{testFile("a", "old")}},
+			upper:           []testEntry{testFile("a", "new"), testWhiteout(".wh.a")},
+			expectedEntries: []string{"a"},
+		},
+		{
+			name:            "whiteout removes directory contents",
+			lower:           [][]testEntry{{testDir("a"), testFile("a/x", ""), testFile("b", "")}},
+			upper:           []testEntry{testWhiteout(".wh.a")},
+			expectedEntries: []string{"b"},
+		},
+		{
+			name:            "opaque whiteout after the directory contents",
+			lower:           [][]testEntry{{testDir("a"), testFile("a/x", ""), testFile("a/y", "")}},
+			upper:           []testEntry{testDir("a"), testFile("a/x", ""), testWhiteout("a/.wh..wh..opq")},
+			expectedEntries: []string{"a", "a/x"},
+		},
+		{
+			name: "conflicts with the merged lower layers",
+			lower: [][]testEntry{
+				{testFile("a", ""), testFile("b", "")},
+				{testWhiteout(".wh.a")},
+			},
+			upper:             []testEntry{testFile("b", ""), testFile("a", "")},
+			expectedConflicts: []string{"b"},
+			expectedEntries:   []string{"a", "b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var lower []v1.Layer
+			for _, entries := range test.lower {
+				lower = append(lower, newTestLayer(t, entries...))
+			}
+
+			fs, err := NewFileSystem(lower)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			conflicts, err := fs.Apply(newTestLayer(t, test.upper...))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var conflictPaths []string
+			for _, conflict := range conflicts {
+				conflictPaths = append(conflictPaths, conflict.Path)
+			}
+			if !slices.Equal(conflictPaths, test.expectedConflicts) {
+				t.Errorf("expected conflicts %q, got %q", test.expectedConflicts, conflictPaths)
+			}
+
+			if entries := slices.Sorted(maps.Keys(fs.entries)); !slices.Equal(entries, test.expectedEntries) {
+				t.Errorf("expected entries %q, got %q", test.expectedEntries, entries)
+			}
+		})
+	}
+}
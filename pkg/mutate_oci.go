@@ -18,6 +18,7 @@ package pkg
 
 import (
 	"fmt"
+	"slices"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/match"
@@ -28,11 +29,43 @@ type IndexMutateFn func(index v1.ImageIndex) (v1.ImageIndex, error)
 type ImageMutateFn func(image v1.Image) (v1.Image, error)
 type DescriptorMutateFn func(descriptor v1.Descriptor) (v1.Descriptor, error)
 
+// ImageDescriptorsMutateFn is an ImageMutateFn that also gets the descriptors
+// from the root index down to the image, like an ImageSearchFn.
+type ImageDescriptorsMutateFn func(descriptors []*v1.Descriptor, image v1.Image) (v1.Image, error)
+
 func MutateOCITree(
 	index v1.ImageIndex,
 	mutIndexFn IndexMutateFn,
 	mutImageFn ImageMutateFn,
 	mutDescriptorFn DescriptorMutateFn,
+) (v1.ImageIndex, error) {
+	var mutImageDescriptorsFn ImageDescriptorsMutateFn
+	if mutImageFn != nil {
+		mutImageDescriptorsFn = func(_ []*v1.Descriptor, image v1.Image) (v1.Image, error) {
+			return mutImageFn(image)
+		}
+	}
+
+	return mutateOCITree(index, nil, mutIndexFn, mutImageDescriptorsFn, mutDescriptorFn)
+}
+
+// MutateOCITreeWithDescriptors is MutateOCITree for an image mutation that
+// depends on the descriptors of the image, e.g. on its platform.
+func MutateOCITreeWithDescriptors(
+	index v1.ImageIndex,
+	mutIndexFn IndexMutateFn,
+	mutImageFn ImageDescriptorsMutateFn,
+	mutDescriptorFn DescriptorMutateFn,
+) (v1.ImageIndex, error) {
+	return mutateOCITree(index, nil, mutIndexFn, mutImageFn, mutDescriptorFn)
+}
+
+func mutateOCITree(
+	index v1.ImageIndex,
+	descriptors []*v1.Descriptor,
+	mutIndexFn IndexMutateFn,
+	mutImageFn ImageDescriptorsMutateFn,
+	mutDescriptorFn DescriptorMutateFn,
 ) (v1.ImageIndex, error) {
 	manifest, err := index.IndexManifest()
 	if err != nil {
@@ -40,6 +73,8 @@ func MutateOCITree(
 	}
 
 	for _, descriptor := range manifest.Manifests {
+		childDescriptors := append(slices.Clip(descriptors), &descriptor)
+
 		var child mutate.Appendable
 
 		switch {
@@ -50,7 +85,7 @@ func MutateOCITree(
 			}
 
 			if mutImageFn != nil {
-				childImg, err = mutImageFn(childImg)
+				childImg, err = mutImageFn(childDescriptors, childImg)
 				if err != nil {
 					return nil, fmt.Errorf("could not mutate oci image: %w", err)
 				}
@@ -62,7 +97,7 @@ func MutateOCITree(
 				return nil, fmt.Errorf("could not load oci image index from digest: %w", err)
 			}
 
-			childIndex, err = MutateOCITree(childIndex, mutIndexFn, mutImageFn, mutDescriptorFn)
+			childIndex, err = mutateOCITree(childIndex, childDescriptors, mutIndexFn, mutImageFn, mutDescriptorFn)
 			if err != nil {
 				return nil, err
 			}
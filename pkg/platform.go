@@ -0,0 +1,67 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkg
+
+import (
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// ImagePlatform returns the platform of an image found while walking an OCI
+// tree. The platform from the image config takes precedence over the platform
+// of the closest parent descriptor that has one. Returns nil if neither is set.
+func ImagePlatform(descriptors []*v1.Descriptor, image v1.Image) (*v1.Platform, error) {
+	var platform *v1.Platform
+
+	for _, desc := range descriptors {
+		if desc.Platform != nil {
+			platform = desc.Platform
+		}
+	}
+
+	cfg, err := image.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("could not load image config: %w", err)
+	}
+	if imgPlatform := cfg.Platform(); imgPlatform != nil {
+		platform = imgPlatform
+	}
+
+	return platform, nil
+}
+
+// MatchesPlatform returns true if the platform satisfies any of the given
+// platform specs. An empty list of specs matches every platform, including a
+// nil platform.
+func MatchesPlatform(platform *v1.Platform, specs []v1.Platform) bool {
+	if len(specs) == 0 {
+		return true
+	}
+
+	if platform == nil {
+		return false
+	}
+
+	for _, spec := range specs {
+		if platform.Satisfies(spec) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkg
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+// Rebase returns a copy of the image where the bottom layers, which must be
+// the layers of oldBase, are replaced by the layers of newBase. The history of
+// oldBase is replaced by the history of newBase. Config fields that the image
+// inherited unchanged from oldBase are taken from newBase, fields that were
+// changed by the image are kept. The platform is taken from newBase.
+func Rebase(img, oldBase, newBase v1.Image) (v1.Image, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("could not get image layers: %w", err)
+	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("could not get image manifest: %w", err)
+	}
+	configFile, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("could not parse config file: %w", err)
+	}
+
+	oldConfigFile, err := oldBase.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("could not parse old base config file: %w", err)
+	}
+
+	newLayers, err := newBase.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("could not get new base layers: %w", err)
+	}
+	newManifest, err := newBase.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("could not get new base manifest: %w", err)
+	}
+	newConfigFile, err := newBase.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("could not parse new base config file: %w", err)
+	}
+
+	diffIDs := configFile.RootFS.DiffIDs
+	oldDiffIDs := oldConfigFile.RootFS.DiffIDs
+	if len(oldDiffIDs) > len(diffIDs) {
+		return nil, fmt.Errorf("image is not based on the old base: the old base has %d layers, the image only %d", len(oldDiffIDs), len(diffIDs))
+	}
+	for i, oldDiffID := range oldDiffIDs {
+		if diffIDs[i] != oldDiffID {
+			return nil, fmt.Errorf("image is not based on the old base: layer %d has diff_id %s, the old base has %s", i, diffIDs[i], oldDiffID)
+		}
+	}
+
+	history, err := rebaseHistory(configFile.History, oldConfigFile.History, newConfigFile.History, len(oldDiffIDs), len(newLayers))
+	if err != nil {
+		return nil, err
+	}
+
+	adds := make([]mutate.Addendum, 0, len(newLayers)+len(layers)-len(oldDiffIDs))
+	for i := range newLayers {
+		adds = append(adds, existingLayer(newManifest, newLayers, i))
+	}
+	for i := len(oldDiffIDs); i < len(layers); i++ {
+		adds = append(adds, existingLayer(manifest, layers, i))
+	}
+
+	configFile = configFile.DeepCopy()
+	configFile.Architecture = newConfigFile.Architecture
+	configFile.OS = newConfigFile.OS
+	configFile.OSVersion = newConfigFile.OSVersion
+	configFile.OSFeatures = newConfigFile.OSFeatures
+	configFile.Variant = newConfigFile.Variant
+	configFile.Config = rebaseConfig(configFile.Config, oldConfigFile.Config, newConfigFile.Config)
+
+	return rebuildImage(img, manifest, configFile, adds, history)
+}
+
+// rebaseHistory replaces the history entries of the old base at the start of
+// the image history with the history of the new base.
+func rebaseHistory(history, oldHistory, newHistory []v1.History, oldLayerCount, newLayerCount int) ([]v1.History, error) {
+	if len(history) == 0 {
+		return nil, nil
+	}
+
+	// The old base history is a prefix of the image history, without old
+	// base history the base part ends after the last old base layer
+	split := len(oldHistory)
+	if split == 0 {
+		for layerCount := 0; split < len(history) && layerCount < oldLayerCount; split++ {
+			if !history[split].EmptyLayer {
+				layerCount++
+			}
+		}
+	}
+
+	if split > len(history) {
+		return nil, fmt.Errorf("image history has %d entries, but the old base history has %d", len(history), split)
+	}
+
+	layerCount := 0
+	for _, entry := range history[:split] {
+		if !entry.EmptyLayer {
+			layerCount++
+		}
+	}
+	if layerCount != oldLayerCount {
+		return nil, fmt.Errorf("image history does not start with the old base history: found %d layers, expected %d", layerCount, oldLayerCount)
+	}
+
+	// Without new base history, a history entry is created for every layer,
+	// so the history still matches the layers
+	if len(newHistory) == 0 {
+		newHistory = make([]v1.History, newLayerCount)
+	}
+
+	result := make([]v1.History, 0, len(newHistory)+len(history)-split)
+	result = append(result, newHistory...)
+	result = append(result, history[split:]...)
+	return result, nil
+}
+
+// rebaseConfig merges the image config with the config of the new base: values
+// that are equal to the value in the old base were inherited and are replaced
+// by the value of the new base. Env, labels, exposed ports and volumes are
+// merged per key.
+func rebaseConfig(config, oldConfig, newConfig v1.Config) v1.Config {
+	config.Entrypoint = rebaseValue(config.Entrypoint, oldConfig.Entrypoint, newConfig.Entrypoint)
+	config.Cmd = rebaseValue(config.Cmd, oldConfig.Cmd, newConfig.Cmd)
+	config.User = rebaseValue(config.User, oldConfig.User, newConfig.User)
+	config.WorkingDir = rebaseValue(config.WorkingDir, oldConfig.WorkingDir, newConfig.WorkingDir)
+	config.StopSignal = rebaseValue(config.StopSignal, oldConfig.StopSignal, newConfig.StopSignal)
+	config.Shell = rebaseValue(config.Shell, oldConfig.Shell, newConfig.Shell)
+	config.Healthcheck = rebaseValue(config.Healthcheck, oldConfig.Healthcheck, newConfig.Healthcheck)
+
+	config.Env = rebaseEnv(config.Env, oldConfig.Env, newConfig.Env)
+	config.Labels = rebaseMap(config.Labels, oldConfig.Labels, newConfig.Labels)
+	config.ExposedPorts = rebaseMap(config.ExposedPorts, oldConfig.ExposedPorts, newConfig.ExposedPorts)
+	config.Volumes = rebaseMap(config.Volumes, oldConfig.Volumes, newConfig.Volumes)
+
+	return config
+}
+
+func rebaseValue[T any](value, oldValue, newValue T) T {
+	if reflect.DeepEqual(value, oldValue) {
+		return newValue
+	}
+	return value
+}
+
+// rebaseMap keeps the keys that the image added or changed, follows the new
+// base for the keys that were inherited from the old base and adds the keys
+// that are new in the new base. Keys that the image removed stay removed.
+func rebaseMap[V comparable](values, oldValues, newValues map[string]V) map[string]V {
+	result := map[string]V{}
+
+	for key, value := range values {
+		if oldValue, ok := oldValues[key]; ok && oldValue == value {
+			if newValue, ok := newValues[key]; ok {
+				result[key] = newValue
+			}
+			continue
+		}
+		result[key] = value
+	}
+
+	for key, newValue := range newValues {
+		_, inOld := oldValues[key]
+		_, inImage := values[key]
+		if !inOld && !inImage {
+			result[key] = newValue
+		}
+	}
+
+	if len(result) == 0 && values == nil {
+		return nil
+	}
+	return result
+}
+
+// rebaseEnv merges the environment variables like rebaseMap, keeping the order
+// of the image variables and adding new variables at the end.
+func rebaseEnv(env, oldEnv, newEnv []string) []string {
+	keys := func(env []string) ([]string, map[string]string) {
+		order := make([]string, 0, len(env))
+		values := make(map[string]string, len(env))
+		for _, entry := range env {
+			key, value, _ := strings.Cut(entry, "=")
+			if _, ok := values[key]; !ok {
+				order = append(order, key)
+			}
+			values[key] = value
+		}
+		return order, values
+	}
+
+	order, values := keys(env)
+	_, oldValues := keys(oldEnv)
+	newOrder, newValues := keys(newEnv)
+
+	merged := rebaseMap(values, oldValues, newValues)
+
+	var result []string
+	for _, key := range append(order, newOrder...) {
+		if value, ok := merged[key]; ok {
+			result = append(result, key+"="+value)
+			delete(merged, key)
+		}
+	}
+	return result
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkg
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestRebaseConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    v1.Config
+		oldConfig v1.Config
+		newConfig v1.Config
+		expected  v1.Config
+	}{
+		{
+			name:      "inherited values follow the new base",
+			config:    v1.Config{User: "old", Entrypoint: []string{"/old"}},
+			oldConfig: v1.Config{User: "old", Entrypoint: []string{"/old"}},
+			newConfig: v1.Config{User: "new", Entrypoint: []string{"/new"}},
+			expected:  v1.Config{User: "new", Entrypoint: []string{"/new"}},
+		},
+		{
+			name:      "changed values are kept",
+			config:    v1.Config{User: "app", Cmd: []string{"serve"}},
+			oldConfig: v1.Config{User: "old", Cmd: []string{"sh"}},
+			newConfig: v1.Config{User: "new", Cmd: []string{"bash"}},
+			expected:  v1.Config{User: "app", Cmd: []string{"serve"}},
+		},
+		{
+			name:      "values removed from the new base are removed",
+			config:    v1.Config{WorkingDir: "/old"},
+			oldConfig: v1.Config{WorkingDir: "/old"},
+			newConfig: v1.Config{},
+			expected:  v1.Config{},
+		},
+		{
+			name: "labels are merged per key",
+			config: v1.Config{Labels: map[string]string{
+				"inherited": "old",
+				"changed":   "app",
+				"added":     "app",
+			}},
+			oldConfig: v1.Config{Labels: map[string]string{
+				"inherited": "old",
+				"changed":   "old",
+				"removed":   "old",
+				"dropped":   "old",
+			}},
+			newConfig: v1.Config{Labels: map[string]string{
+				"inherited": "new",
+				"changed":   "new",
+				"removed":   "new",
+				"base":      "new",
+			}},
+			expected: v1.Config{Labels: map[string]string{
+				"inherited": "new",
+				"changed":   "app",
+				"added":     "app",
+				"base":      "new",
+			}},
+		},
+		{
+			name:      "ports and volumes are merged per key",
+			config:    v1.Config{ExposedPorts: map[string]struct{}{"80/tcp": {}, "8080/tcp": {}}, Volumes: map[string]struct{}{"/old": {}}},
+			oldConfig: v1.Config{ExposedPorts: map[string]struct{}{"80/tcp": {}}, Volumes: map[string]struct{}{"/old": {}}},
+			newConfig: v1.Config{ExposedPorts: map[string]struct{}{"443/tcp": {}}, Volumes: map[string]struct{}{"/new": {}}},
+			expected:  v1.Config{ExposedPorts: map[string]struct{}{"8080/tcp": {}, "443/tcp": {}}, Volumes: map[string]struct{}{"/new": {}}},
+		},
+		{
+			name:      "env is merged per key in image order",
+			config:    v1.Config{Env: []string{"APP=1", "PATH=/old", "LANG=app"}},
+			oldConfig: v1.Config{Env: []string{"PATH=/old", "LANG=C"}},
+			newConfig: v1.Config{Env: []string{"TZ=UTC", "PATH=/new", "LANG=C.UTF-8"}},
+			expected:  v1.Config{Env: []string{"APP=1", "PATH=/new", "LANG=app", "TZ=UTC"}},
+		},
+		{
+			name:      "nil maps of the image stay nil",
+			config:    v1.Config{},
+			oldConfig: v1.Config{Labels: map[string]string{"a": "old"}},
+			newConfig: v1.Config{},
+			expected:  v1.Config{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if config := rebaseConfig(test.config, test.oldConfig, test.newConfig); !reflect.DeepEqual(config, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, config)
+			}
+		})
+	}
+}
@@ -18,6 +18,8 @@ package pkg
 
 import (
 	"encoding/json"
+	"fmt"
+	"maps"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
@@ -37,7 +39,45 @@ func ReplaceImageIndexAnnotations(f v1.ImageIndex, annotations map[string]string
 	}
 }
 
-func replaceAnnotations(f partial.WithRawManifest, annotations map[string]string) ([]byte, error) {
+// MergeImageAnnotations is like ReplaceImageAnnotations, but keeps the
+// existing annotations that are not in set or remove.
+func MergeImageAnnotations(f v1.Image, set map[string]string, remove []string) v1.Image {
+	return imageAnnotationsReplacer{
+		Image:       f,
+		annotations: set,
+		remove:      remove,
+		merge:       true,
+	}
+}
+
+// MergeImageIndexAnnotations is like ReplaceImageIndexAnnotations, but keeps
+// the existing annotations that are not in set or remove.
+func MergeImageIndexAnnotations(f v1.ImageIndex, set map[string]string, remove []string) v1.ImageIndex {
+	return indexAnnotationsReplacer{
+		embededImageIndex: f,
+		annotations:       set,
+		remove:            remove,
+		merge:             true,
+	}
+}
+
+// MergeAnnotations returns a copy of annotations where the keys in set are
+// added or replaced and the keys in remove are deleted.
+func MergeAnnotations(annotations map[string]string, set map[string]string, remove []string) map[string]string {
+	result := maps.Clone(annotations)
+	if result == nil {
+		result = map[string]string{}
+	}
+
+	for _, key := range remove {
+		delete(result, key)
+	}
+	maps.Copy(result, set)
+
+	return result
+}
+
+func replaceAnnotations(f partial.WithRawManifest, annotations map[string]string, remove []string, merge bool) ([]byte, error) {
 	b, err := f.RawManifest()
 	if err != nil {
 		return nil, err
@@ -48,6 +88,17 @@ func replaceAnnotations(f partial.WithRawManifest, annotations map[string]string
 		return nil, err
 	}
 
+	if merge {
+		var existing struct {
+			Annotations map[string]string `json:"annotations"`
+		}
+		if err := json.Unmarshal(b, &existing); err != nil {
+			return nil, fmt.Errorf("could not parse annotations: %w", err)
+		}
+
+		annotations = MergeAnnotations(existing.Annotations, annotations, remove)
+	}
+
 	if len(annotations) == 0 {
 		delete(m, "annotations")
 	} else {
@@ -60,10 +111,12 @@ func replaceAnnotations(f partial.WithRawManifest, annotations map[string]string
 type imageAnnotationsReplacer struct {
 	v1.Image
 	annotations map[string]string
+	remove      []string
+	merge       bool
 }
 
 func (a imageAnnotationsReplacer) RawManifest() ([]byte, error) {
-	return replaceAnnotations(a.Image, a.annotations)
+	return replaceAnnotations(a.Image, a.annotations, a.remove, a.merge)
 }
 
 func (a imageAnnotationsReplacer) Digest() (v1.Hash, error) {
@@ -83,10 +136,12 @@ type embededImageIndex = v1.ImageIndex
 type indexAnnotationsReplacer struct {
 	embededImageIndex
 	annotations map[string]string
+	remove      []string
+	merge       bool
 }
 
 func (a indexAnnotationsReplacer) RawManifest() ([]byte, error) {
-	return replaceAnnotations(a.embededImageIndex, a.annotations)
+	return replaceAnnotations(a.embededImageIndex, a.annotations, a.remove, a.merge)
 }
 
 func (a indexAnnotationsReplacer) Digest() (v1.Hash, error) {
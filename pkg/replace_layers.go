@@ -0,0 +1,207 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkg
+
+import (
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+// ReplaceLayers returns a copy of the image where the layers [from, to) and
+// their history entries are replaced by the replacements. Addendums without
+// layer only add a history entry. The layer descriptors of the other layers,
+// the image config and the manifest annotations are kept. If the image has no
+// history, the result has no history either.
+func ReplaceLayers(img v1.Image, from, to int, replacements []mutate.Addendum) (v1.Image, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("could not get image layers: %w", err)
+	}
+
+	if from < 0 || to > len(layers) || from > to {
+		return nil, fmt.Errorf("invalid layer range [%d, %d) for image with %d layers", from, to, len(layers))
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("could not get image manifest: %w", err)
+	}
+
+	configFile, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("could not parse config file: %w", err)
+	}
+
+	history, err := replaceHistory(configFile.History, len(layers), from, to, replacements)
+	if err != nil {
+		return nil, err
+	}
+
+	adds := make([]mutate.Addendum, 0, len(layers)-(to-from)+len(replacements))
+	for i := range from {
+		adds = append(adds, existingLayer(manifest, layers, i))
+	}
+	for _, replacement := range replacements {
+		if replacement.Layer != nil {
+			adds = append(adds, replacement)
+		}
+	}
+	for i := to; i < len(layers); i++ {
+		adds = append(adds, existingLayer(manifest, layers, i))
+	}
+
+	return rebuildImage(img, manifest, configFile, adds, history)
+}
+
+// RewriteLayers returns a copy of the image where every layer is replaced by
+// the result of fn, layers for which fn returns nil are kept. The history, the
+// image config and the manifest annotations are kept, the layer annotations
+// are kept for layers that are replaced too.
+func RewriteLayers(img v1.Image, fn func(index int, layer v1.Layer) (v1.Layer, error)) (v1.Image, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("could not get image layers: %w", err)
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("could not get image manifest: %w", err)
+	}
+
+	configFile, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("could not parse config file: %w", err)
+	}
+
+	adds := make([]mutate.Addendum, 0, len(layers))
+	for i, layer := range layers {
+		replacement, err := fn(i, layer)
+		if err != nil {
+			return nil, err
+		}
+
+		if replacement == nil {
+			adds = append(adds, existingLayer(manifest, layers, i))
+			continue
+		}
+
+		adds = append(adds, mutate.Addendum{
+			Layer:       replacement,
+			Annotations: manifest.Layers[i].Annotations,
+		})
+	}
+
+	return rebuildImage(img, manifest, configFile, adds, configFile.History)
+}
+
+func existingLayer(manifest *v1.Manifest, layers []v1.Layer, i int) mutate.Addendum {
+	return mutate.Addendum{
+		Layer:       layers[i],
+		Annotations: manifest.Layers[i].Annotations,
+		URLs:        manifest.Layers[i].URLs,
+		MediaType:   manifest.Layers[i].MediaType,
+	}
+}
+
+// rebuildImage creates an image with the media types, config and manifest
+// annotations of img, the layers adds and the given history.
+func rebuildImage(img v1.Image, manifest *v1.Manifest, configFile *v1.ConfigFile, adds []mutate.Addendum, history []v1.History) (v1.Image, error) {
+	mediaType, err := img.MediaType()
+	if err != nil {
+		return nil, fmt.Errorf("could not get image media type: %w", err)
+	}
+
+	configFile = configFile.DeepCopy()
+	configFile.RootFS.DiffIDs = nil
+	configFile.History = nil
+
+	base := mutate.MediaType(empty.Image, mediaType)
+	base = mutate.ConfigMediaType(base, manifest.Config.MediaType)
+	base, err = mutate.ConfigFile(base, configFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not replace config file: %w", err)
+	}
+
+	result, err := mutate.Append(base, adds...)
+	if err != nil {
+		return nil, fmt.Errorf("could not append layers: %w", err)
+	}
+
+	// mutate.Append adds a history entry for every layer, replace them with
+	// the merged history
+	configFile, err = result.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("could not parse config file: %w", err)
+	}
+	configFile = configFile.DeepCopy()
+	configFile.History = history
+
+	result, err = mutate.ConfigFile(result, configFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not replace config file: %w", err)
+	}
+
+	if len(manifest.Annotations) > 0 {
+		result = mutate.Annotations(result, manifest.Annotations).(v1.Image)
+	}
+	if manifest.Subject != nil {
+		result = mutate.Subject(result, *manifest.Subject).(v1.Image)
+	}
+
+	return result, nil
+}
+
+// replaceHistory replaces the history entries of the layers [from, to),
+// including the empty layer entries in between, with the replacement history.
+func replaceHistory(history []v1.History, layerCount, from, to int, replacements []mutate.Addendum) ([]v1.History, error) {
+	if len(history) == 0 {
+		return nil, nil
+	}
+
+	var before, after []v1.History
+	layerIndex := 0
+	for _, entry := range history {
+		switch {
+		case entry.EmptyLayer && layerIndex <= from, !entry.EmptyLayer && layerIndex < from:
+			before = append(before, entry)
+		case layerIndex >= to:
+			after = append(after, entry)
+		}
+
+		if !entry.EmptyLayer {
+			layerIndex++
+		}
+	}
+
+	if layerIndex != layerCount {
+		return nil, fmt.Errorf("image history references %d layers, but the image has %d layers", layerIndex, layerCount)
+	}
+
+	result := make([]v1.History, 0, len(before)+len(replacements)+len(after))
+	result = append(result, before...)
+	for _, replacement := range replacements {
+		entry := replacement.History
+		entry.EmptyLayer = replacement.Layer == nil
+		result = append(result, entry)
+	}
+	result = append(result, after...)
+
+	return result, nil
+}
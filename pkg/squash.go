@@ -0,0 +1,293 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkg
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+const (
+	WhiteoutPrefix = ".wh."
+	WhiteoutOpaque = WhiteoutPrefix + WhiteoutPrefix + ".opq"
+)
+
+// CleanEntryName returns the tar entry name relative to the image root,
+// without leading "./" or "/" and without trailing slash. The image root
+// itself is ".".
+func CleanEntryName(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+type entryKind int
+
+const (
+	entryDir entryKind = iota
+	entryNonDir
+	entryWhiteout
+)
+
+// overlay tracks which paths are decided by upper layers while walking the
+// layers of an image from the top layer down.
+type overlay struct {
+	entries map[string]entryKind
+	opaque  map[string]bool
+}
+
+func newOverlay() *overlay {
+	return &overlay{
+		entries: map[string]entryKind{},
+		opaque:  map[string]bool{},
+	}
+}
+
+// hiddenByParent returns true if a parent directory of name was removed,
+// replaced by a non-directory or made opaque by an upper layer.
+func (o *overlay) hiddenByParent(name string) bool {
+	for name != "." {
+		name = path.Dir(name)
+		if kind, ok := o.entries[name]; ok && kind != entryDir {
+			return true
+		}
+		if o.opaque[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *overlay) merge(layer *overlay) {
+	for name, kind := range layer.entries {
+		o.entries[name] = kind
+	}
+	for name := range layer.opaque {
+		o.opaque[name] = true
+	}
+}
+
+// squashDecision describes what happens to a single tar entry of a layer
+// when squashing, entries without decision are dropped.
+type squashDecision struct {
+	// name replaces the entry name, used to turn whiteouts of directories
+	// that are recreated by upper layers into opaque whiteouts, and to move
+	// a removed file to the first hardlink that still points to it
+	name string
+
+	// linkname replaces the target of a hardlink whose target was moved
+	linkname string
+}
+
+// squashLink is a hardlink entry that is kept when squashing.
+type squashLink struct {
+	ordinal int
+	name    string
+	target  string
+}
+
+// SquashLayers writes a single uncompressed layer to w that has the same effect
+// as applying the layers in order (lowest layer first). Whiteouts are applied to
+// the squashed layers. If keepWhiteouts is set, whiteouts that may apply to
+// layers below the squashed layers are kept in the output. A hardlink whose
+// target is removed or replaced by an upper layer keeps the contents of the
+// target.
+func SquashLayers(w io.Writer, layers []v1.Layer, keepWhiteouts bool) error {
+	decisions := make([]map[int]squashDecision, len(layers))
+
+	state := newOverlay()
+	for i := len(layers) - 1; i >= 0; i-- {
+		layerState := newOverlay()
+		decisions[i] = map[int]squashDecision{}
+
+		files := map[string]int{}
+		var links []squashLink
+
+		err := walkLayer(layers[i], func(ordinal int, header *tar.Header, _ io.Reader) error {
+			name := CleanEntryName(header.Name)
+			dir, base := path.Split(name)
+			dir = CleanEntryName(dir)
+
+			switch {
+			case base == WhiteoutOpaque:
+				if kind, ok := state.entries[dir]; (ok && kind != entryDir) || state.opaque[dir] || state.hiddenByParent(dir) {
+					return nil
+				}
+
+				layerState.opaque[dir] = true
+				if keepWhiteouts {
+					decisions[i][ordinal] = squashDecision{name: name}
+				}
+			case strings.HasPrefix(base, WhiteoutPrefix):
+				target := path.Join(dir, strings.TrimPrefix(base, WhiteoutPrefix))
+				if state.hiddenByParent(target) {
+					return nil
+				}
+
+				if kind, ok := state.entries[target]; ok {
+					// A directory recreated by an upper layer must not show
+					// the contents of lower layers
+					if kind == entryDir && !state.opaque[target] {
+						layerState.opaque[target] = true
+						if keepWhiteouts {
+							decisions[i][ordinal] = squashDecision{name: path.Join(target, WhiteoutOpaque)}
+						}
+					}
+					return nil
+				}
+
+				layerState.entries[target] = entryWhiteout
+				if keepWhiteouts {
+					decisions[i][ordinal] = squashDecision{name: name}
+				}
+			default:
+				if header.Typeflag == tar.TypeReg {
+					files[name] = ordinal
+				}
+
+				if _, ok := state.entries[name]; ok || state.hiddenByParent(name) {
+					return nil
+				}
+
+				kind := entryNonDir
+				if header.Typeflag == tar.TypeDir {
+					kind = entryDir
+				}
+
+				layerState.entries[name] = kind
+				decisions[i][ordinal] = squashDecision{name: name}
+
+				if header.Typeflag == tar.TypeLink {
+					links = append(links, squashLink{
+						ordinal: ordinal,
+						name:    name,
+						target:  CleanEntryName(header.Linkname),
+					})
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// A hardlink keeps the contents of its target when an upper layer
+		// removes or replaces the target, so the target file is moved to
+		// the first hardlink and the other hardlinks point to that path
+		moved := map[string]string{}
+		for _, link := range links {
+			if movedTo, ok := moved[link.target]; ok {
+				decisions[i][link.ordinal] = squashDecision{name: link.name, linkname: movedTo}
+				continue
+			}
+
+			target, ok := files[link.target]
+			if !ok {
+				continue
+			}
+			if _, kept := decisions[i][target]; kept {
+				continue
+			}
+
+			decisions[i][target] = squashDecision{name: link.name}
+			delete(decisions[i], link.ordinal)
+			moved[link.target] = link.name
+		}
+
+		state.merge(layerState)
+	}
+
+	tw := tar.NewWriter(w)
+	written := map[string]bool{}
+	for i, layer := range layers {
+		err := walkLayer(layer, func(ordinal int, header *tar.Header, contents io.Reader) error {
+			decision, ok := decisions[i][ordinal]
+			if !ok {
+				return nil
+			}
+
+			header.Name = decision.name
+			if header.Typeflag == tar.TypeDir {
+				header.Name += "/"
+			}
+
+			if header.Typeflag == tar.TypeLink {
+				header.Linkname = CleanEntryName(header.Linkname)
+				if decision.linkname != "" {
+					header.Linkname = decision.linkname
+				}
+				if !written[header.Linkname] {
+					return fmt.Errorf("hardlink %q points to %q, which is not in the squashed layers", decision.name, header.Linkname)
+				}
+			}
+
+			header.Format = tar.FormatPAX
+			if err := tw.WriteHeader(header); err != nil {
+				return fmt.Errorf("could not write tar header: %w", err)
+			}
+			if _, err := io.Copy(tw, contents); err != nil {
+				return fmt.Errorf("could not write tar contents: %w", err)
+			}
+
+			written[decision.name] = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+func walkLayer(layer v1.Layer, fn func(ordinal int, header *tar.Header, contents io.Reader) error) error {
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return fmt.Errorf("could not read layer: %w", err)
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	for ordinal := 0; ; ordinal++ {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("could not read layer tarball: %w", err)
+		}
+
+		if err := fn(ordinal, header, tr); err != nil {
+			return err
+		}
+	}
+
+	// Read until the end, so the layer digest is verified
+	if _, err := io.Copy(io.Discard, rc); err != nil {
+		return fmt.Errorf("could not read layer: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkg
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// testEntry is a tar entry of a test layer.
+type testEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	contents string
+	modTime  time.Time
+}
+
+func testFile(name, contents string) testEntry {
+	return testEntry{name: name, typeflag: tar.TypeReg, contents: contents}
+}
+
+func testDir(name string) testEntry {
+	return testEntry{name: name, typeflag: tar.TypeDir}
+}
+
+func testHardlink(name, target string) testEntry {
+	return testEntry{name: name, typeflag: tar.TypeLink, linkname: target}
+}
+
+func testWhiteout(name string) testEntry {
+	return testFile(name, "")
+}
+
+func newTestLayer(t *testing.T, entries ...testEntry) v1.Layer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: entry.typeflag,
+			Name:     entry.name,
+			Linkname: entry.linkname,
+			Mode:     0644,
+			Size:     int64(len(entry.contents)),
+			ModTime:  entry.modTime,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, entry.contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layer
+}
+
+// readTestLayer returns the entries of the layer as "name/" for directories,
+// "name -> target" for hardlinks and "name=contents" for other entries.
+func readTestLayer(t *testing.T, r io.Reader) []string {
+	t.Helper()
+
+	var entries []string
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			entries = append(entries, header.Name)
+		case tar.TypeLink:
+			entries = append(entries, header.Name+" -> "+header.Linkname)
+		default:
+			contents, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries = append(entries, header.Name+"="+string(contents))
+		}
+	}
+	return entries
+}
+
+func TestSquashLayers(t *testing.T) {
+	tests := []struct {
+		name          string
+		layers        [][]testEntry
+		keepWhiteouts bool
+		expected      []string
+	}{
+		{
+			name: "upper layer replaces file",
+			layers: [][]testEntry{
+				{testDir("etc"), testFile("etc/passwd", "old"), testFile("etc/group", "group")},
+				{testFile("etc/passwd", "new")},
+			},
+			expected: []string{"etc/", "etc/group=group", "etc/passwd=new"},
+		},
+		{
+			name: "whiteout removes file and directory",
+			layers: [][]testEntry{
+				{testDir("a"), testFile("a/x", "x"), testFile("b", "b"), testFile("c", "c")},
+				{testWhiteout(".wh.a"), testWhiteout(".wh.b")},
+			},
+			expected: []string{"c=c"},
+		},
+		{
+			name: "whiteout is kept for lower layers",
+			layers: [][]testEntry{
+				{testFile("a", "a")},
+				{testWhiteout(".wh.b")},
+			},
+			keepWhiteouts: true,
+			expected:      []string{"a=a", ".wh.b="},
+		},
+		{
+			name: "opaque whiteout hides lower directory contents",
+			layers: [][]testEntry{
+				{testDir("a"), testFile("a/x", "x")},
+				{testDir("a"), testWhiteout("a/.wh..wh..opq"), testFile("a/y", "y")},
+			},
+			expected: []string{"a/", "a/y=y"},
+		},
+		{
+			name: "hardlink to file in the same layer",
+			layers: [][]testEntry{
+				{testFile("a", "data"), testHardlink("b", "a")},
+			},
+			expected: []string{"a=data", "b -> a"},
+		},
+		{
+			name: "hardlink keeps contents of removed target",
+			layers: [][]testEntry{
+				{testDir("opt"), testFile("opt/b", "data"), testDir("opt/sub"), testHardlink("opt/sub/a", "opt/b")},
+				{testWhiteout("opt/.wh.b")},
+			},
+			expected: []string{"opt/", "opt/sub/a=data", "opt/sub/"},
+		},
+		{
+			name: "hardlinks point to the first hardlink of removed target",
+			layers: [][]testEntry{
+				{testFile("b", "data"), testHardlink("c", "b"), testHardlink("d", "b")},
+				{testWhiteout(".wh.b")},
+			},
+			expected: []string{"c=data", "d -> c"},
+		},
+		{
+			name: "hardlink keeps contents of replaced target",
+			layers: [][]testEntry{
+				{testFile("b", "old"), testHardlink("c", "b")},
+				{testFile("b", "new")},
+			},
+			expected: []string{"c=old", "b=new"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var layers []v1.Layer
+			for _, entries := range test.layers {
+				layers = append(layers, newTestLayer(t, entries...))
+			}
+
+			var buf bytes.Buffer
+			if err := SquashLayers(&buf, layers, test.keepWhiteouts); err != nil {
+				t.Fatal(err)
+			}
+
+			if entries := readTestLayer(t, &buf); !slices.Equal(entries, test.expected) {
+				t.Errorf("expected entries %q, got %q", test.expected, entries)
+			}
+		})
+	}
+}
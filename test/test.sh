@@ -121,4 +121,242 @@ else
     echo "✅︎ Found no labels as expected"
 fi
 
+# image_manifests prints the paths of the image manifests in the OCI layout,
+# the nested indices are followed
+image_manifests() {
+    local file="$1/${2:-index.json}"
+    if jq -e 'has("layers")' "$file" > /dev/null; then
+        echo "$file"
+        return
+    fi
+
+    for digest in $(jq -r '.manifests[].digest' "$file"); do
+        image_manifests "$1" "blobs/sha256/${digest#sha256:}"
+    done
+}
+
+rm -rf _bin/test/test-squash
+cp -r _bin/test/test-oci _bin/test/test-squash
+_bin/test/image-tool squash-layers _bin/test/test-squash
+for manifest in $(image_manifests _bin/test/test-squash); do
+    if [ "$(jq '.layers | length' "$manifest")" != "1" ]; then
+        echo "❌ Expected a single layer after squash-layers"
+        exit 1
+    fi
+
+    layer="_bin/test/test-squash/blobs/sha256/$(jq -r '.layers[0].digest' "$manifest" | cut -d: -f2)"
+    if ! tar -tzf "$layer" | grep -x hello > /dev/null; then
+        echo "❌ Expected hello to be in the squashed layer"
+        exit 1
+    fi
+done
+echo "✅︎ Found a single squashed layer with hello as expected"
+
+# The app image is the test image with an extra layer, it is rebased from the
+# test image onto the squashed test image with an extra env variable
+rm -rf _bin/test/test-app _bin/test/test-new-base
+cp -r _bin/test/test-oci _bin/test/test-app
+cp -r _bin/test/test-squash _bin/test/test-new-base
+_bin/test/image-tool append-files _bin/test/test-app test/test.Dockerfile:/app/
+_bin/test/image-tool mutate-config _bin/test/test-new-base --env NEW_BASE=true
+_bin/test/image-tool rebase _bin/test/test-app --old-base _bin/test/test-oci --new-base _bin/test/test-new-base
+for manifest in $(image_manifests _bin/test/test-app); do
+    if [ "$(jq '.layers | length' "$manifest")" != "2" ]; then
+        echo "❌ Expected the squashed base layer and the app layer after rebase"
+        exit 1
+    fi
+
+    layer="_bin/test/test-app/blobs/sha256/$(jq -r '.layers[1].digest' "$manifest" | cut -d: -f2)"
+    if ! tar -tzf "$layer" | grep -x app/test.Dockerfile > /dev/null; then
+        echo "❌ Expected app/test.Dockerfile to be in the top layer"
+        exit 1
+    fi
+
+    config="_bin/test/test-app/blobs/sha256/$(jq -r '.config.digest' "$manifest" | cut -d: -f2)"
+    if ! jq -r '.config.Env[]' "$config" | grep -x NEW_BASE=true > /dev/null; then
+        echo "❌ Expected NEW_BASE=true to be in the env"
+        exit 1
+    fi
+done
+echo "✅︎ Found the app layer on the new base as expected"
+
+# Docker can output a symlinked blobs directory and hardlinked files, a
+# symlink that escapes the output directory must be rejected
+rm -rf _bin/test/test-links-src _bin/test/test-links _bin/test/test-escape
+cp -r _bin/test/test-oci _bin/test/test-links-src
+mv _bin/test/test-links-src/blobs _bin/test/test-links-src/store
+ln -s store _bin/test/test-links-src/blobs
+ln _bin/test/test-links-src/index.json _bin/test/test-links-src/index.json.orig
+tar -cf _bin/test/test-links.tar -C _bin/test/test-links-src .
+_bin/test/image-tool convert-from-oci-tar _bin/test/test-links.tar _bin/test/test-links
+if [ ! -L _bin/test/test-links/blobs ] || [ "$(_bin/test/image-tool list-digests _bin/test/test-links)" != "$(_bin/test/image-tool list-digests _bin/test/test-oci)" ]; then
+    echo "❌ Expected the OCI layout with a symlinked blobs directory"
+    exit 1
+else
+    echo "✅︎ Found the OCI layout with a symlinked blobs directory as expected"
+fi
+
+# Mutating commands garbage collect the blobs through the symlink
+blobs_before=$(ls _bin/test/test-links/store/sha256 | wc -l)
+_bin/test/image-tool reset-timestamps _bin/test/test-links
+if [ ! -L _bin/test/test-links/blobs ] || [ "$(ls _bin/test/test-links/store/sha256 | wc -l)" != "$blobs_before" ] || ! _bin/test/image-tool list-digests _bin/test/test-links > /dev/null; then
+    echo "❌ Expected reset-timestamps to garbage collect the symlinked blobs directory"
+    exit 1
+else
+    echo "✅︎ Garbage collected the symlinked blobs directory as expected"
+fi
+
+ln -s ../../outside _bin/test/test-links-src/escape
+tar -cf _bin/test/test-escape.tar -C _bin/test/test-links-src .
+if _bin/test/image-tool convert-from-oci-tar _bin/test/test-escape.tar _bin/test/test-escape; then
+    echo "❌ Expected the symlink that escapes the output directory to be rejected"
+    exit 1
+else
+    echo "✅︎ Rejected the symlink that escapes the output directory as expected"
+fi
+
+# layout_checksums prints the checksums of index.json and the blobs of the OCI
+# layout, following a symlinked blobs directory
+layout_checksums() {
+    (cd "$1" && find -L index.json blobs -type f -exec sha256sum {} + | sort)
+}
+
+checksums=$(layout_checksums _bin/test/test-oci)
+_bin/test/image-tool --dry-run append-files _bin/test/test-oci test/test.Dockerfile:/app/ > _bin/test/dry-run.txt
+_bin/test/image-tool --dry-run squash-layers _bin/test/test-oci >> _bin/test/dry-run.txt
+_bin/test/image-tool --dry-run convert-from-oci-tar _bin/test/test-links.tar _bin/test/test-oci >> _bin/test/dry-run.txt
+if [ "$(layout_checksums _bin/test/test-oci)" != "$checksums" ] || [ "$(grep -c "nothing was written" _bin/test/dry-run.txt)" != "3" ]; then
+    echo "❌ Expected --dry-run to report the changes without writing them"
+    exit 1
+else
+    echo "✅︎ Reported the --dry-run changes without writing them as expected"
+fi
+
+rm -rf _bin/test/test-remove
+cp -r _bin/test/test-oci _bin/test/test-remove
+_bin/test/image-tool remove-paths _bin/test/test-remove /hello
+for manifest in $(image_manifests _bin/test/test-remove); do
+    layer="_bin/test/test-remove/blobs/sha256/$(jq -r '.layers[-1].digest' "$manifest" | cut -d: -f2)"
+    if [ "$(tar -tzf "$layer")" != ".wh.hello" ]; then
+        echo "❌ Expected a whiteout layer for hello after remove-paths"
+        exit 1
+    fi
+done
+echo "✅︎ Found a whiteout layer for hello as expected"
+
+rm -rf _bin/test/test-zstd
+cp -r _bin/test/test-oci _bin/test/test-zstd
+_bin/test/image-tool append-files --compression zstd --compression-level 19 _bin/test/test-zstd test/test.Dockerfile:/app/
+for manifest in $(image_manifests _bin/test/test-zstd); do
+    layer="_bin/test/test-zstd/blobs/sha256/$(jq -r '.layers[-1].digest' "$manifest" | cut -d: -f2)"
+    if [ "$(jq -r '.layers[-1].mediaType' "$manifest")" != "application/vnd.oci.image.layer.v1.tar+zstd" ] || [ "$(head -c 4 "$layer" | od -An -tx1 | tr -d ' ')" != "28b52ffd" ]; then
+        echo "❌ Expected a zstd compressed layer after append-files --compression zstd"
+        exit 1
+    fi
+done
+echo "✅︎ Found a zstd compressed layer as expected"
+
+_bin/test/image-tool set-labels-and-annotations _bin/test/test-oci --label keep.a=1 --label drop.b=2 --label drop.c=3 --label drop.c-
+labels=$(find_labels | sort -u | tr '\n' ' ')
+if [ "$labels" != "drop.b=2 keep.a=1 " ]; then
+    echo "❌ Expected the labels drop.b=2 and keep.a=1, found $labels"
+    exit 1
+else
+    echo "✅︎ Found the labels set by set-labels-and-annotations as expected"
+fi
+
+_bin/test/image-tool reset-labels-and-annotations _bin/test/test-oci --keep-label 'keep.*'
+labels=$(find_labels | sort -u | tr '\n' ' ')
+if [ "$labels" != "keep.a=1 " ]; then
+    echo "❌ Expected only the label keep.a=1, found $labels"
+    exit 1
+else
+    echo "✅︎ Found only the kept label as expected"
+fi
+
+rm -rf _bin/test/test-timestamps
+cp -r _bin/test/test-oci _bin/test/test-timestamps
+_bin/test/image-tool reset-timestamps --timestamp 2025-01-01T00:00:00Z _bin/test/test-timestamps
+for manifest in $(image_manifests _bin/test/test-timestamps); do
+    config="_bin/test/test-timestamps/blobs/sha256/$(jq -r '.config.digest' "$manifest" | cut -d: -f2)"
+    if [ "$(jq -c '[.created] + [.history[].created] | unique' "$config")" != '["2025-01-01T00:00:00Z"]' ]; then
+        echo "❌ Expected all config timestamps to be 2025-01-01T00:00:00Z after reset-timestamps"
+        exit 1
+    fi
+done
+echo "✅︎ Found the reset config timestamps as expected"
+
+rm -rf _bin/test/test-layer-timestamps
+cp -r _bin/test/test-oci _bin/test/test-layer-timestamps
+_bin/test/image-tool reset-layer-timestamps --timestamp 2025-01-01T00:00:00Z _bin/test/test-layer-timestamps
+for manifest in $(image_manifests _bin/test/test-layer-timestamps); do
+    for digest in $(jq -r '.layers[].digest' "$manifest"); do
+        layer="_bin/test/test-layer-timestamps/blobs/sha256/${digest#sha256:}"
+        if TZ=UTC tar --full-time -tvf "$layer" | awk '$4 " " $5 > "2025-01-01 00:00:00" { found = 1 } END { exit !found }'; then
+            echo "❌ Expected no modification time after 2025-01-01T00:00:00Z in $layer after reset-layer-timestamps"
+            exit 1
+        fi
+    done
+done
+echo "✅︎ Found only clamped layer timestamps as expected"
+
+rm -rf _bin/test/test-copy
+cp -r _bin/test/test-oci _bin/test/test-copy
+_bin/test/image-tool copy-from _bin/test/test-copy --from _bin/test/test-oci /hello:/copied/
+for manifest in $(image_manifests _bin/test/test-copy); do
+    layer="_bin/test/test-copy/blobs/sha256/$(jq -r '.layers[-1].digest' "$manifest" | cut -d: -f2)"
+    if [ "$(tar -xOzf "$layer" copied/hello)" != "Hello" ]; then
+        echo "❌ Expected copied/hello in the layer appended by copy-from"
+        exit 1
+    fi
+done
+echo "✅︎ Found copied/hello in the appended layer as expected"
+
+rm -rf _bin/test/test-plain _bin/test/test-stdin
+_bin/test/image-tool convert-from-oci-tar _bin/test/test-oci.tar _bin/test/test-plain
+gzip -c _bin/test/test-oci.tar | _bin/test/image-tool convert-from-oci-tar - _bin/test/test-stdin
+if [ "$(layout_checksums _bin/test/test-stdin)" != "$(layout_checksums _bin/test/test-plain)" ]; then
+    echo "❌ Expected the same layout from a gzipped tarball on stdin"
+    exit 1
+else
+    echo "✅︎ Found the same layout from a gzipped tarball on stdin as expected"
+fi
+
+for limit in "--max-entries 1" "--max-file-size 1" "--max-total-size 1" "--max-entries -1"; do
+    rm -rf _bin/test/test-limits
+    if _bin/test/image-tool convert-from-oci-tar $limit _bin/test/test-oci.tar _bin/test/test-limits 2> _bin/test/limits.txt || ! grep -q -- "--max-" _bin/test/limits.txt; then
+        echo "❌ Expected convert-from-oci-tar $limit to fail naming the limit"
+        exit 1
+    fi
+done
+echo "✅︎ Found the extraction limits enforced as expected"
+
+rm -rf _bin/test/test-append _bin/test/append-arm64
+cp -r _bin/test/test-oci _bin/test/test-append
+mkdir -p _bin/test/append-arm64
+echo "arm64" > _bin/test/append-arm64/arm64.txt
+_bin/test/image-tool append-layers _bin/test/test-append linux/arm64=_bin/test/append-arm64
+for manifest in $(image_manifests _bin/test/test-append); do
+    config="_bin/test/test-append/blobs/sha256/$(jq -r '.config.digest' "$manifest" | cut -d: -f2)"
+    layer="_bin/test/test-append/blobs/sha256/$(jq -r '.layers[-1].digest' "$manifest" | cut -d: -f2)"
+    if tar -tzf "$layer" | grep -x arm64.txt > /dev/null; then
+        appended=arm64
+    else
+        appended=none
+    fi
+    expected=none
+    if [ "$(jq -r '.architecture' "$config")" == "arm64" ]; then
+        expected=arm64
+    fi
+    if [ "$appended" != "$expected" ]; then
+        echo "❌ Expected the platform-keyed layer to only be appended to the arm64 image"
+        exit 1
+    fi
+done
+if _bin/test/image-tool append-layers _bin/test/test-append linux/s390x=_bin/test/append-arm64 2> /dev/null; then
+    echo "❌ Expected append-layers to fail for a platform that matches no image"
+    exit 1
+fi
+echo "✅︎ Found the platform-keyed layer only in the arm64 image as expected"
+
 popd